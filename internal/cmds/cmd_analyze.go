@@ -14,20 +14,31 @@ func RunAnalyzeCmd(args []string) {
 
 	output := cmd.String("o", "output.csv", "Output file")
 	format := cmd.String("format", "csv", "Output format (csv/bin (wip))")
-	winsize := cmd.Int("winsize", 4096, "Window size used for the FFT (must be a power of two)")
+	winsize := cmd.Int("winsize", 4096, "Window size used for the FFT, in samples")
+	windowName := cmd.String("window", "hann", "Analysis window: "+signal.WindowNames())
+	channelName := cmd.String("channel", "mix", "Channels to analyze, 'all' writes a column set per channel: "+signal.ChannelModeNames())
 
 	cmd.Parse(args)
 
 	if cmd.NArg() < 1 {
 		fmt.Println("Error. Missing audio file")
-		fmt.Println("Usage: audateci analyze [options] <audio_file.wav>")
+		fmt.Println("Usage: audateci analyze [options] <audio-file>")
 		fmt.Println("Available options are:")
 		cmd.PrintDefaults()
 		os.Exit(1)
 	}
 	inputFile := cmd.Arg(0)
 
-	data, err := signal.ReadWavToFloats(inputFile)
+	window, err := signal.ParseWindow(*windowName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	channels, err := signal.ParseChannelMode(*channelName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := signal.ReadAudio(inputFile)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -36,9 +47,11 @@ func RunAnalyzeCmd(args []string) {
 
 	fmt.Printf("File '%s' read successfully\n", inputFile)
 	fmt.Printf("Sample frequency: %d Hz \n", data.SampleRate)
-	fmt.Printf("Channels: %d\n", len(data.Channels))
+	fmt.Printf("Channels: %d (analyzing %s)\n", len(data.Channels), channels)
 	fmt.Printf("Samples per channel: %d\n", len(samples))
 	fmt.Printf("Window size for FFT: %d\n", *winsize)
+	fmt.Printf("Window function: %s (coherent gain %.3f, ENBW %.2f bins)\n",
+		window.Name, window.CoherentGain(*winsize), window.ENBW(*winsize))
 	fmt.Printf("Outputing results to: %s.%s\n", *output, *format)
 
 	if *format != "csv" {
@@ -52,6 +65,6 @@ func RunAnalyzeCmd(args []string) {
 	defer outFile.Close()
 
 	start := time.Now()
-	signal.GenerateCSV(inputFile, outFile, *winsize)
+	signal.GenerateCSV(inputFile, outFile, *winsize, window, channels)
 	fmt.Printf("Finished in %.3fs\n", time.Since(start).Seconds())
 }
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	signal "audateci/internal/signal"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func RunConvertCmd(args []string) {
+	cmd := flag.NewFlagSet("convert", flag.ExitOnError)
+
+	rate := cmd.Int("rate", 0, "Output sample rate in Hz, 0 keeps the input rate")
+	channelName := cmd.String("channel", "all", "Output channels, 'all' keeps the layout and any other mode writes mono: "+signal.ChannelModeNames())
+	formatName := cmd.String("format", "16", "Output sample format: 16, 24, 32 or f32")
+	start := cmd.Float64("start", 0, "Start of the converted fragment, in seconds")
+	duration := cmd.Float64("duration", 0, "Length of the converted fragment in seconds, 0 converts up to the end")
+
+	cmd.Parse(args)
+
+	if cmd.NArg() < 2 {
+		fmt.Println("Error. Missing input or output file")
+		fmt.Println("Usage: audateci convert [options] <audio-file> <output.wav>")
+		fmt.Println("Available options are:")
+		cmd.PrintDefaults()
+		os.Exit(1)
+	}
+	inputFile, outputFile := cmd.Arg(0), cmd.Arg(1)
+
+	if ext := strings.ToLower(filepath.Ext(outputFile)); ext != ".wav" && ext != ".wave" {
+		log.Fatalf("Unsupported output file '%s', only wav can be written", outputFile)
+	}
+	channels, err := signal.ParseChannelMode(*channelName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	format, err := signal.ParseSampleFormat(*formatName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	startTime := time.Now()
+	frames, err := convertAudio(inputFile, outputFile, *rate, channels, format, *start, *duration)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Wrote %d frames to '%s' in %.3fs\n", frames, outputFile, time.Since(startTime).Seconds())
+}
+
+// convertAudio streams inputFile through the channel mixer and the
+// resampler into a new wav file, returning the number of frames written.
+func convertAudio(inputFile, outputFile string, rate int, channels signal.ChannelMode, format signal.SampleFormat, start, duration float64) (int64, error) {
+	r, err := signal.OpenAudio(inputFile)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	inputRate := r.SampleRate()
+	if rate == 0 {
+		rate = inputRate
+	}
+
+	if start > 0 {
+		if _, err := r.Seek(int64(start*float64(inputRate)), io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+
+	modes := channels.Split(r.Channels())
+	readers, err := signal.MixReaders(r, modes)
+	if err != nil {
+		return 0, err
+	}
+	for i := range readers {
+		if duration > 0 {
+			readers[i] = signal.LimitSamples(readers[i], int64(duration*float64(inputRate)))
+		}
+		readers[i], err = signal.NewResampler(readers[i], inputRate, rate)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	fmt.Printf("Converting '%s' (%d Hz, %d channels) to %d Hz, %d channels, %s\n",
+		inputFile, inputRate, r.Channels(), rate, len(modes), format)
+
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	w, err := signal.NewWAVWriter(f, rate, len(modes), format)
+	if err != nil {
+		return 0, err
+	}
+
+	// Every reader advances by the same number of samples per round, as
+	// MixReaders requires.
+	buf := make([][]float64, len(readers))
+	for i := range buf {
+		buf[i] = make([]float64, 8192)
+	}
+	var written int64
+	for {
+		n := len(buf[0])
+		for i, reader := range readers {
+			got, err := readFull(reader, buf[i][:n])
+			if err != nil && err != io.EOF {
+				return written, err
+			}
+			n = min(n, got)
+		}
+		if n == 0 {
+			break
+		}
+
+		chunk := make([][]float64, len(buf))
+		for i := range buf {
+			chunk[i] = buf[i][:n]
+		}
+		if err := w.Write(chunk); err != nil {
+			return written, err
+		}
+		written += int64(n)
+	}
+
+	if err := w.Close(); err != nil {
+		return written, err
+	}
+	return written, f.Close()
+}
+
+// readFull reads until buf is full or the reader is drained.
+func readFull(r signal.SampleReader, buf []float64) (int, error) {
+	n := 0
+	for n < len(buf) {
+		got, err := r.ReadSamples(buf[n:])
+		n += got
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,347 @@
+package cmd
+
+import (
+	"audateci/internal/fingerprint"
+	"audateci/internal/index"
+	signal "audateci/internal/signal"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dbUsage = "Usage: audateci db <add|rm|ls|stats|verify> [options] <database-dir> ..."
+
+func RunDbCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Println(dbUsage)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "add":
+		runDbAdd(args[1:])
+	case "rm":
+		runDbRemove(args[1:])
+	case "ls":
+		runDbList(args[1:])
+	case "stats":
+		runDbStats(args[1:])
+	case "verify":
+		runDbVerify(args[1:])
+	default:
+		fmt.Printf("Unknown db command '%s'\n", args[0])
+		fmt.Println(dbUsage)
+		os.Exit(1)
+	}
+}
+
+// parseDbFlags parses the options of a db command, which must be followed by
+// the database directory and at least minArgs more arguments.
+func parseDbFlags(cmd *flag.FlagSet, args []string, usage string, minArgs int) (string, []string) {
+	// The database records its parameters once it holds a song, these only
+	// apply to an empty one and to legacy fingerprints.
+	cmd.IntVar(&windowSize, "winsize", 2048, "Size of the FFT window songs are analyzed with while the database is empty, also assumed for fingerprints older than version 3")
+	cmd.IntVar(&analysisRate, "rate", signal.AnalysisSampleRate, "Sample rate in Hz songs are analyzed at while the database is empty, also assumed for fingerprints older than version 3")
+	cmd.Parse(args)
+
+	if cmd.NArg() < 1+minArgs {
+		fmt.Println("Usage: audateci db " + usage)
+		fmt.Println("Available options are:")
+		cmd.PrintDefaults()
+		os.Exit(1)
+	}
+	return cmd.Arg(0), cmd.Args()[1:]
+}
+
+// loadIndex reads the index of the database in dir to change it, or
+// rebuilds it from the fingerprints when it is missing or out of date.
+func loadIndex(dir string) *index.Memory {
+	indexPath := filepath.Join(dir, index.FileName)
+	idx, err := index.Open(indexPath)
+	switch {
+	case err == nil:
+		defer idx.Close()
+		if stale := idx.Stale(dir); stale != nil {
+			log.Printf("Index '%s' is out of date (%v), rebuilding it", indexPath, stale)
+			break
+		}
+		return idx.Memory()
+	case !errors.Is(err, fs.ErrNotExist):
+		log.Printf("Cannot use index: %v, rebuilding it", err)
+	}
+
+	mem, skipped, err := index.Scan(dir, defaultAnalysis())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, err := range skipped {
+		log.Printf("Skipping %v", err)
+	}
+	return mem
+}
+
+// databaseParams returns the parameters to fingerprint the songs added to
+// the database of mem with. They must match the fingerprints already in it,
+// the analysis flags only apply to a new one.
+func databaseParams(mem *index.Memory) fingerprint.Params {
+	if len(mem.Songs()) == 0 {
+		return defaultAnalysis()
+	}
+	params := mem.Params()
+	fmt.Printf("Using the parameters of the database: %d Hz, window %d, hop %d, %s bands\n",
+		params.SampleRate, params.WindowSize, params.HopSize, params.Bands.Name)
+	return params
+}
+
+func runDbAdd(args []string) {
+	cmd := flag.NewFlagSet("db add", flag.ExitOnError)
+	format := cmd.String("format", "json", "Fingerprint format: json or binary")
+	replace := cmd.Bool("replace", false, "Fingerprint again songs that are already in the database")
+	addPeakFlags(cmd)
+	addBandFlags(cmd)
+	dbFolder, files := parseDbFlags(cmd, args, "add [options] <database-dir> <audio-file-or-dir>...", 1)
+
+	ext, err := fingerprint.FormatExt(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(dbFolder, 0o755); err != nil {
+		log.Fatal(err)
+	}
+
+	var audio []string
+	for _, arg := range files {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			found, err := signal.GlobAudioFiles(arg)
+			if err != nil {
+				log.Fatal(err)
+			}
+			audio = append(audio, found...)
+		} else {
+			audio = append(audio, arg)
+		}
+	}
+
+	mem := loadIndex(dbFolder)
+	params := databaseParams(mem)
+
+	added := 0
+	for i, file := range audio {
+		name := songName(file)
+		base := sanitizeFilename(name)
+		fmt.Printf("[%d/%d] Processing '%s'...\n", i+1, len(audio), name)
+
+		existing := ""
+		for _, e := range []string{fingerprint.JSONExt, fingerprint.BinaryExt} {
+			if _, err := os.Stat(filepath.Join(dbFolder, base+e)); err == nil {
+				existing = base + e
+			}
+		}
+		if existing != "" && !*replace {
+			fmt.Printf("   Skipping (already in the database as '%s')\n", existing)
+			continue
+		}
+
+		fp, err := fingerprintAudio(file, name, params)
+		if err != nil {
+			fmt.Printf("   Error: %v\n", err)
+			continue
+		}
+		if len(fp.Points) == 0 {
+			fmt.Printf("   Warning: no audio data found in %s\n", file)
+			continue
+		}
+
+		// A song fingerprinted again keeps its ID.
+		fp.ID = mem.NextID()
+		if existing != "" {
+			for _, song := range mem.Songs() {
+				if song.File == existing {
+					fp.ID = song.ID
+				}
+			}
+			mem.RemoveFile(existing)
+			if err := os.Remove(filepath.Join(dbFolder, existing)); err != nil {
+				log.Fatal(err)
+			}
+		}
+		output := filepath.Join(dbFolder, base+ext)
+		if err := fingerprint.Save(output, fp, false); err != nil {
+			log.Fatal(err)
+		}
+		if err := mem.Add(fp, output); err != nil {
+			log.Fatal(err)
+		}
+		added++
+		fmt.Printf("   Added '%s' with ID %d as '%s' (%d points, %d hashes)\n", fp.Meta.Title, fp.ID, output, len(fp.Points), len(fp.Hashes))
+	}
+
+	if err := mem.Write(filepath.Join(dbFolder, index.FileName)); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Added %d songs, the database holds %d\n", added, len(mem.Songs()))
+}
+
+func runDbRemove(args []string) {
+	cmd := flag.NewFlagSet("db rm", flag.ExitOnError)
+	dbFolder, names := parseDbFlags(cmd, args, "rm [options] <database-dir> <song-id-name-or-fingerprint-file>...", 1)
+
+	mem := loadIndex(dbFolder)
+	removed := 0
+	for _, name := range names {
+		file := ""
+		for _, song := range mem.Songs() {
+			if matchesSong(song, name) {
+				file = song.File
+				break
+			}
+		}
+		// Fingerprints the index skipped can still be removed by file name.
+		if file == "" {
+			if _, err := os.Stat(filepath.Join(dbFolder, filepath.Base(name))); err == nil {
+				file = filepath.Base(name)
+			}
+		}
+		if file == "" {
+			fmt.Printf("'%s' is not in the database\n", name)
+			continue
+		}
+
+		mem.RemoveFile(file)
+		if err := os.Remove(filepath.Join(dbFolder, file)); err != nil {
+			log.Fatal(err)
+		}
+		removed++
+		fmt.Printf("Removed '%s'\n", file)
+	}
+
+	if err := mem.Write(filepath.Join(dbFolder, index.FileName)); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Removed %d songs, the database holds %d\n", removed, len(mem.Songs()))
+}
+
+// matchesSong reports whether arg names song, by its ID, its name or its
+// fingerprint file.
+func matchesSong(song index.Song, arg string) bool {
+	if id, err := strconv.ParseUint(arg, 10, 32); err == nil {
+		return uint32(id) == song.ID
+	}
+	return song.Name == arg || song.File == arg || strings.TrimSuffix(song.File, filepath.Ext(song.File)) == arg
+}
+
+func runDbList(args []string) {
+	cmd := flag.NewFlagSet("db ls", flag.ExitOnError)
+	asJSON := cmd.Bool("json", false, "Print the catalogue records as json")
+	dbFolder, _ := parseDbFlags(cmd, args, "ls [options] <database-dir>", 0)
+
+	db := loadDatabase(dbFolder)
+	defer db.Index.Close()
+	songs := slices.SortedFunc(slices.Values(db.Index.Songs()), func(a, b index.Song) int { return cmp.Compare(a.ID, b.ID) })
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(songs); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var total time.Duration
+	points := 0
+	fmt.Printf("%5s  %-40s %-24s %9s %8s %8s  %s\n", "ID", "Song", "Album", "Duration", "Points", "Hashes", "File")
+	for _, song := range songs {
+		d := time.Duration(song.Duration * float64(time.Second)).Round(time.Second)
+		total += d
+		points += song.Points
+		fmt.Printf("%5d  %-40s %-24s %9s %8d %8d  %s\n", song.ID, song.Title(), song.Meta.Album, d, song.Points, song.Hashes, song.File)
+	}
+	fmt.Printf("%d songs, %v of audio, %d points\n", len(songs), total, points)
+}
+
+func runDbStats(args []string) {
+	cmd := flag.NewFlagSet("db stats", flag.ExitOnError)
+	top := cmd.Int("top", 10, "Number of most crowded hashes to show")
+	dbFolder, _ := parseDbFlags(cmd, args, "stats [options] <database-dir>", 0)
+
+	mem := loadIndex(dbFolder)
+	st := mem.Stats(*top)
+	params := mem.Params()
+
+	fmt.Printf("Songs:           %d\n", st.Songs)
+	fmt.Printf("Distinct hashes: %d\n", st.Hashes)
+	fmt.Printf("Postings:        %d\n", st.Postings)
+	if st.Hashes == 0 {
+		return
+	}
+	fmt.Printf("Postings/hash:   %.2f\n", float64(st.Postings)/float64(st.Hashes))
+
+	fmt.Println("\nPostings per hash:")
+	for b, n := range st.Buckets {
+		lo, hi := 1<<b, 1<<(b+1)-1
+		label := fmt.Sprintf("%d-%d", lo, hi)
+		if lo == hi {
+			label = fmt.Sprint(lo)
+		}
+		fmt.Printf("  %-12s %9d hashes (%5.1f%%)\n", label, n, 100*float64(n)/float64(st.Hashes))
+	}
+
+	fmt.Println("\nMost crowded hashes:")
+	fmt.Printf("  %-8s %9s %9s %6s %8s %6s\n", "Hash", "Anchor", "Target", "Δt", "Postings", "Songs")
+	step := params.Pairing()
+	for _, b := range st.Crowded {
+		anchor, target, delta := signal.SplitHash(b.Hash)
+		fmt.Printf("  %08x %7.0fHz %7.0fHz %6d %8d %6d\n", b.Hash, float64(anchor)*step.FreqStep, float64(target)*step.FreqStep, delta, b.Postings, b.Songs)
+	}
+}
+
+func runDbVerify(args []string) {
+	cmd := flag.NewFlagSet("db verify", flag.ExitOnError)
+	dbFolder, _ := parseDbFlags(cmd, args, "verify [options] <database-dir>", 0)
+
+	indexPath := filepath.Join(dbFolder, index.FileName)
+	idx, err := index.Open(indexPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer idx.Close()
+
+	failed := false
+	check := func(what string, err error) {
+		if err != nil {
+			fmt.Printf("%-12s FAILED: %v\n", what, err)
+			failed = true
+		} else {
+			fmt.Printf("%-12s ok\n", what)
+		}
+	}
+
+	check("Checksum", idx.Verify())
+	check("Files", idx.Stale(dbFolder))
+
+	scanned, skipped, err := index.Scan(dbFolder, defaultAnalysis())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, err := range skipped {
+		fmt.Printf("Skipped %v\n", err)
+	}
+	check("Postings", idx.Memory().Diff(scanned))
+
+	if failed {
+		fmt.Printf("Index '%s' does not match the fingerprints, run 'audateci index build %s'\n", indexPath, dbFolder)
+		os.Exit(1)
+	}
+	fmt.Printf("Index '%s' matches its %d fingerprints\n", indexPath, len(idx.Songs()))
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"audateci/internal/match"
 	"fmt"
 	"log"
 	"path/filepath"
@@ -12,24 +13,25 @@ func RunDemoCmd() {
 	secondSongPath := "./fragments_test/misterio-nada-sospechoso.wav"
 
 	fmt.Printf("Cargando base de datos de canciones %s...\n", dbPath)
-	dbIndex := loadDatabase(dbPath)
+	db := loadDatabase(dbPath)
 
 	fmt.Printf("Identificando primera canción: %s\n", filepath.Base(firstSongPath))
-	firstRes, err := identifyAudio(firstSongPath, dbIndex)
+	firstRes, err := identifyAudio(firstSongPath, db, match.Options{Top: 1, FPR: match.DefaultFPR})
 	if err != nil {
 		log.Fatal(err)
 	}
+	first := firstRes.Best()
 
-	songTitle := filepath.Base(firstRes.BestMatch)
-	url, err := getVideoURL(songTitle)
+	songTitle := candidateTitle(first)
+	url, err := songURL(first.Song)
 	if err != nil {
 		fmt.Printf("Unnable to get url for best matching song: '%s'", songTitle)
 		url = "NONE"
 	}
 
 	fmt.Printf("   Resultado:       %s (%s)\n", songTitle, url)
-	fmt.Printf("   Desfase:         %.1fs\n", firstRes.Offset)
-	fmt.Printf("   Puntuación (%%):  %.2f%%\n", firstRes.Confidence)
+	fmt.Printf("   Desfase:         %.1fs\n", first.Offset)
+	fmt.Printf("   Puntuación:      %.2f\n", first.Normalized)
 
 	err = openURL(url)
 	if err != nil {
@@ -37,23 +39,24 @@ func RunDemoCmd() {
 	}
 
 	fmt.Printf("\nIdentificando segunda canción: ???\n")
-	secondRes, err := identifyAudio(secondSongPath, dbIndex)
+	secondRes, err := identifyAudio(secondSongPath, db, match.Options{Top: 1, FPR: match.DefaultFPR})
 	if err != nil {
 		log.Fatal(err)
 	}
+	second := secondRes.Best()
 
-	songTitle = filepath.Base(secondRes.BestMatch)
-	url, err = getVideoURL(songTitle)
+	songTitle = candidateTitle(second)
+	url, err = songURL(second.Song)
 	if err != nil {
 		fmt.Printf("Unnable to get url for best matching song: '%s'", songTitle)
 		url = "NONE"
 	}
 
-	url += fmt.Sprintf("&autoplay=1&start=%d", int(secondRes.Offset))
+	url += fmt.Sprintf("&autoplay=1&start=%d", int(second.Offset))
 
 	fmt.Printf("   Resultado:       %s (%s)\n", songTitle, url)
-	fmt.Printf("   Desfase:         %.1fs\n", secondRes.Offset)
-	fmt.Printf("   Puntuación (%%):  %.2f%%\n", secondRes.Confidence)
+	fmt.Printf("   Desfase:         %.1fs\n", second.Offset)
+	fmt.Printf("   Puntuación:      %.2f\n", second.Normalized)
 
 	err = openURL(url)
 	if err != nil {
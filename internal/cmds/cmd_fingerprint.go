@@ -1,77 +1,193 @@
 package cmd
 
 import (
+	"audateci/internal/fingerprint"
 	"audateci/internal/signal"
-	"encoding/json"
+	"cmp"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"time"
 )
 
-type AudioFingerprint struct {
-	Filename   string            `json:"filename"`
-	Duration   float64           `json:"duration"`
-	SampleRate int               `json:"sample_rate"`
-	Points     []signal.KeyPoint `json:"points"`
-}
-
 func RunFingerprintCmd(args []string) {
 	cmd := flag.NewFlagSet("fingerprint", flag.ExitOnError)
-	output := cmd.String("o", "fingerprint.json", "Output file (.json)")
-	windowSize := cmd.Int("winsize", 2048, "Window size used for fft, must be a power of two")
+	output := cmd.String("o", "fingerprint.json", "Output file, .json or "+fingerprint.BinaryExt+" for the compact binary format")
+	windowSize := cmd.Int("winsize", 2048, "Window size used for fft, in samples")
+	windowName := cmd.String("window", "hann", "Analysis window: "+signal.WindowNames())
+	rate := cmd.Int("rate", signal.AnalysisSampleRate, "Sample rate in Hz the audio is resampled to before analysis, 0 keeps each file's own rate")
+	channelName := cmd.String("channel", "mix", "Channels to analyze: "+signal.ChannelModeNames())
+	peaks := signal.Peaks2D
+	cmd.TextVar(&peaks, "peaks", signal.Peaks2D, "Peak picking strategy: '2d' local maxima over the noise floor or 'bands' maximum per band")
+	density := cmd.Float64("density", signal.DefaultPeakPicker.Density, "Target number of peaks per second for the 2d strategy")
+	addBandFlags(cmd)
 
 	cmd.Parse(args)
 
 	if cmd.NArg() < 1 {
 		fmt.Println("Error. Missing audio file")
-		fmt.Println("Usage: audateci listen [options] <audio_file.wav>")
+		fmt.Println("Usage: audateci listen [options] <audio-file>")
 		fmt.Println("Available options are:")
 		cmd.PrintDefaults()
 		os.Exit(1)
 	}
 	inputFile := cmd.Arg(0)
 
+	channels, err := signal.ParseChannelMode(*channelName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	params := fingerprint.Params{
+		SampleRate: *rate,
+		WindowSize: *windowSize,
+		HopSize:    *windowSize / 2,
+		Window:     *windowName,
+		Channels:   channels.String(),
+		Peaks:      peaks,
+		Density:    *density,
+		Bands:      bandLayout,
+		Hash:       signal.HashScheme,
+	}
+
 	fmt.Printf("Generating fingerprint for '%s'\n", inputFile)
-	data, err := signal.ReadWavToFloats(inputFile)
+	fp, err := fingerprintAudio(inputFile, inputFile, params)
 	if err != nil {
 		log.Fatal(err)
 	}
-	samples := data.Channels[0]
 
-	var resultPoints []signal.KeyPoint
-	hopSize := *windowSize / 2
+	if err := fingerprint.Save(*output, fp, true); err != nil {
+		log.Fatal("Error saving fingerprint: ", err)
+	}
 
-	for i := 0; i < len(samples)-*windowSize; i += hopSize {
-		chunk := samples[i : i+*windowSize]
-		windowed := signal.ApplyHanningWindow(chunk)
-		padded := signal.PadDataToPowerOfTwo(windowed)
-		fftRes := signal.FFT(padded)
-		magnitudes := signal.ComputeMagnitudes(fftRes)
+	fmt.Printf("Audio fingerprint saved successfully to '%s'. Found %d key points and %d hashes\n", *output, len(fp.Points), len(fp.Hashes))
+}
 
-		currentTime := float64(i) / float64(data.SampleRate)
+// defaultAnalysis builds the parameters identify, import and the REPL share
+// from their flags.
+func defaultAnalysis() fingerprint.Params {
+	return fingerprint.Params{
+		SampleRate: analysisRate,
+		WindowSize: windowSize,
+		HopSize:    windowSize / 2,
+		Window:     signal.Hann.Name,
+		Channels:   channelMode.String(),
+		Peaks:      peakStrategy,
+		Density:    peakDensity,
+		Bands:      bandLayout,
+		Hash:       signal.HashScheme,
+	}
+}
 
-		peaks := signal.GetFingerprintPoints(magnitudes, data.SampleRate, *windowSize, currentTime)
+// fingerprintAudio makes the fingerprint stored for the file at path, under
+// the given name. Its metadata comes from the tags of the file, the title
+// falling back to name.
+func fingerprintAudio(path, name string, params fingerprint.Params) (*fingerprint.File, error) {
+	fp, err := streamKeypoints(path, params)
+	if err != nil {
+		return nil, err
+	}
 
-		resultPoints = append(resultPoints, peaks...)
+	fp.Checksum, err = fingerprint.Checksum(path)
+	if err != nil {
+		return nil, err
 	}
+	fp.Filename = name
+	fp.Tool = fingerprint.ToolVersion()
 
-	fingerprintData := AudioFingerprint{
-		Filename:   inputFile,
-		Duration:   float64(len(samples)) / float64(data.SampleRate),
-		SampleRate: data.SampleRate,
-		Points:     resultPoints,
+	tags, err := signal.ReadTags(path)
+	if err != nil {
+		log.Printf("Ignoring tags: %v", err)
+	}
+	source, err := filepath.Abs(path)
+	if err != nil {
+		source = path
+	}
+	fp.Meta = fingerprint.Metadata{
+		Title:    cmp.Or(tags.Title, name),
+		Artist:   tags.Artist,
+		Album:    tags.Album,
+		Source:   source,
+		Imported: time.Now().UTC().Truncate(time.Second),
+	}
+	return fp, nil
+}
+
+// streamKeypoints fingerprints an audio file without loading it whole into
+// memory. With ChannelAll every channel is analyzed in turn and their key
+// points are merged.
+func streamKeypoints(path string, params fingerprint.Params) (*fingerprint.File, error) {
+	stft, err := params.STFT()
+	if err != nil {
+		return nil, err
+	}
+	channels, err := signal.ParseChannelMode(params.Channels)
+	if err != nil {
+		return nil, err
 	}
 
-	file, _ := os.Create(*output)
-	defer file.Close()
+	r, err := signal.OpenAudio(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if params.SampleRate == 0 {
+		params.SampleRate = r.SampleRate()
+	}
+	rate := params.SampleRate
+
+	// Every channel is paired on its own, a query analyzed as a single
+	// signal never sees pairs across channels.
+	var points []signal.KeyPoint
+	var hashes []signal.Landmark
+	for i, mode := range channels.Split(r.Channels()) {
+		if i > 0 {
+			if _, err := r.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+
+		samples, err := signal.MixReader(r, mode)
+		if err != nil {
+			return nil, err
+		}
+		samples, err = signal.NewResampler(samples, r.SampleRate(), rate)
+		if err != nil {
+			return nil, err
+		}
+
+		extractor := params.Peaks.NewExtractor(stft, rate, params.Bands, params.Density)
+		found, err := signal.GetKeypointsFromReader(stft, samples, rate, extractor)
+		if err != nil {
+			return nil, fmt.Errorf("decoding '%s': %w", path, err)
+		}
+		for j := range found {
+			found[j].Channel = i
+		}
+		points = append(points, found...)
+		hashes = append(hashes, signal.GetLandmarks(found, params.Pairing())...)
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].TimeSec < points[j].TimeSec
+	})
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	jsonerr := encoder.Encode(fingerprintData)
-	if jsonerr != nil {
-		log.Fatal("Error saving JSON:", err)
+	duration := float64(r.Length()) / float64(r.SampleRate())
+	if r.Length() < 0 && len(points) > 0 {
+		// The stream did not announce its length, the last key point is the
+		// best estimate left.
+		duration = points[len(points)-1].TimeSec
 	}
 
-	fmt.Printf("Audio fingerprint saved successfully to '%s'. Found %d key points\n", *output, len(resultPoints))
+	return &fingerprint.File{
+		Version:  fingerprint.Version,
+		Duration: duration,
+		Params:   params,
+		Points:   points,
+		Hashes:   hashes,
+	}, nil
 }
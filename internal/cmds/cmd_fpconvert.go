@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"audateci/internal/fingerprint"
+	signal "audateci/internal/signal"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func RunFingerprintConvertCmd(args []string) {
+	cmd := flag.NewFlagSet("fpconvert", flag.ExitOnError)
+	format := cmd.String("format", "binary", "Output format: json or binary")
+	outputDir := cmd.String("o", "", "Output directory, by default every fingerprint replaces its input")
+	keep := cmd.Bool("keep", false, "Keep the input fingerprints. A directory never holds a song in both formats, so -o is needed to convert a directory")
+	indent := cmd.Bool("indent", false, "Indent json output")
+	cmd.IntVar(&windowSize, "winsize", 2048, "Size of the FFT window assumed for fingerprints older than version 3")
+	cmd.IntVar(&analysisRate, "rate", signal.AnalysisSampleRate, "Sample rate in Hz assumed for fingerprints older than version 3")
+
+	cmd.Parse(args)
+
+	if cmd.NArg() < 1 {
+		fmt.Println("Error. Missing fingerprints to convert")
+		fmt.Println("Usage: audateci fpconvert [options] <fingerprint-or-directory>...")
+		fmt.Println("Available options are:")
+		cmd.PrintDefaults()
+		os.Exit(1)
+	}
+
+	ext, err := fingerprint.FormatExt(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *outputDir != "" {
+		if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var files []string
+	for _, arg := range cmd.Args() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		found, err := fingerprint.Glob(arg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		files = append(files, found...)
+	}
+
+	var inBytes, outBytes int64
+	converted := 0
+	for _, file := range files {
+		fp, err := fingerprint.Load(file, defaultAnalysis())
+		if err != nil {
+			fmt.Printf("Skipping %v\n", err)
+			continue
+		}
+
+		dir := filepath.Dir(file)
+		if *outputDir != "" {
+			dir = *outputDir
+		}
+		size := fileSize(file)
+		output, err := fingerprint.Convert(fp, file, dir, ext, *indent, *keep)
+		if errors.Is(err, fingerprint.ErrBothFormats) {
+			fmt.Printf("Skipping %v\n", err)
+			continue
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		inBytes += size
+		outBytes += fileSize(output)
+		converted++
+		fmt.Printf("'%s' -> '%s'\n", file, output)
+	}
+
+	fmt.Printf("Converted %d of %d fingerprints, %d bytes -> %d bytes\n", converted, len(files), inBytes, outBytes)
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"audateci/internal/fingerprint"
+	"audateci/internal/index"
+	"audateci/internal/match"
 	"audateci/internal/signal"
+	"cmp"
 	"encoding/csv"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"math"
 	"os"
@@ -18,170 +24,372 @@ import (
 	"time"
 )
 
-type IndexEntry struct {
-	SongName string
-	TimeSec  float64
+// database is the index of a directory of fingerprints that were all made
+// with Params.
+type database struct {
+	Index  index.Index
+	Params fingerprint.Params
 }
 
-type FingerprintFile struct {
-	Filename string            `json:"filename"`
-	Points   []signal.KeyPoint `json:"points"`
+// queryParams are the parameters queries are analyzed with: the database's,
+// with the channels asked for on the command line.
+func (db *database) queryParams() fingerprint.Params {
+	params := db.Params
+	params.Channels = channelMode.String()
+	return params
 }
 
 type MatchResult struct {
 	QueryFile   string
-	BestMatch   string
-	Offset      float64
-	Score       int
 	TotalPoints int
-	Confidence  float64
+	// Candidates are the songs that best match the query, best first.
+	Candidates []match.Candidate
+	// Alignment is where the query starts in the best candidate.
+	Alignment   Alignment
 	ProcessTime time.Duration
 }
 
+// Best is the top candidate, or the zero Candidate when no song shares a
+// hash with the query.
+func (r MatchResult) Best() match.Candidate {
+	if len(r.Candidates) == 0 {
+		return match.Candidate{}
+	}
+	return r.Candidates[0]
+}
+
+// Status is the verdict on the query as written to reports.
+func (r MatchResult) Status() string {
+	switch {
+	case r.TotalPoints == 0:
+		return "ERROR"
+	case r.Best().Match:
+		return "MATCH"
+	default:
+		return "NO MATCH"
+	}
+}
+
+// candidateTitle names the song of a candidate, "None" for the zero one.
+func candidateTitle(c match.Candidate) string {
+	return cmp.Or(c.Song.Title(), "None")
+}
+
+// windowSize, analysisRate and the peak settings are the parameters new
+// fingerprints are made with. Readers take them as the parameters of
+// fingerprints older than version 3, which did not record their own.
 var windowSize = 2048
 
-const ConfidenceThreshold = 3.0
+var analysisRate = signal.AnalysisSampleRate
+
+var channelMode = signal.DownmixChannels
+
+var (
+	peakStrategy = signal.Peaks2D
+	peakDensity  = signal.DefaultPeakPicker.Density
+)
+
+// addPeakFlags registers the peak picking flags shared by identify, import
+// and fpdir.
+func addPeakFlags(cmd *flag.FlagSet) {
+	cmd.TextVar(&peakStrategy, "peaks", signal.Peaks2D, "Peak picking strategy: '2d' local maxima over the noise floor or 'bands' maximum per band")
+	cmd.Float64Var(&peakDensity, "density", signal.DefaultPeakPicker.Density, "Target number of peaks per second for the 2d strategy")
+}
+
+// bandLayout is the layout new fingerprints are made with. identify does not
+// take it as a flag, it adopts the parameters of the database it searches.
+var bandLayout = signal.DefaultBandLayout
+
+func addBandFlags(cmd *flag.FlagSet) {
+	cmd.TextVar(&bandLayout, "bands", signal.DefaultBandLayout, "Frequency bands peaks are picked in: 'default', explicit '40-300,300-2000', 'log:N[:min:max]', 'erb:N[:min:max]' or 'bark[:min:max]'")
+}
 
 func RunIdentifyCmd(args []string) {
 	cmd := flag.NewFlagSet("identify", flag.ExitOnError)
-	cmd.IntVar(&windowSize, "winsize", 2048, "Size of the FFT window (must match the one sued to create the fingerprints)")
+	cmd.IntVar(&windowSize, "winsize", 2048, "Size of the FFT window assumed for fingerprints older than version 3, newer ones record it")
+	cmd.IntVar(&analysisRate, "rate", signal.AnalysisSampleRate, "Sample rate in Hz assumed for fingerprints older than version 3, newer ones record it")
+	channelName := cmd.String("channel", "mix", "Channels to analyze: "+signal.ChannelModeNames())
+	addPeakFlags(cmd)
+	top := cmd.Int("top", 3, "Number of ranked candidates to report")
+	fpr := cmd.Float64("fpr", match.DefaultFPR, "Target false-positive rate: highest false-alarm probability accepted as a match")
+	speed := cmd.Float64("speed", 0, "Also search playback speeds up to this much faster or slower, 0.06 for ±6%")
+	speedStep := cmd.Float64("speedstep", 0.01, "Step between the playback speeds searched")
+	freqTol := cmd.Int("ftol", 0, "Number of frequency bins peaks may be off by, with less weight, to tolerate detuned or resampled recordings")
 	outputFile := cmd.String("csv", "reports/test_results.csv", "Name for the report file (only for batch mode)")
 	openYT := cmd.Bool("openYT", false, "Whether to directly open the YT video of the matching song")
+	timeline := cmd.Bool("timeline", false, "Identify the songs playing along a long recording, like a radio show or a DJ mix")
+	span := cmd.Float64("span", 10, "Seconds of recording each stretch is identified from (only for timeline mode)")
+	hop := cmd.Float64("hop", 5, "Seconds between the starts of consecutive stretches (only for timeline mode)")
+	format := cmd.String("format", "cue", "Timeline output: 'cue', 'csv' or 'json' (only for timeline mode)")
+	timelineFile := cmd.String("o", "", "File the timeline is written to, the standard output when empty (only for timeline mode)")
 
 	cmd.Parse(args)
 
 	if cmd.NArg() < 2 {
-		fmt.Println("Usage: audateci identify <directory-with-fingerprints> <audio-fragment.wav>")
+		fmt.Println("Usage: audateci identify <directory-with-fingerprints> <audio-fragment>")
 		os.Exit(1)
 	}
 
 	dbFolder := cmd.Arg(0)
 	inputPath := cmd.Arg(1)
 
-	fmt.Printf("Indexing db directory: '%s'\n", dbFolder)
-	dbIndex := loadDatabase(dbFolder)
+	mode, err := signal.ParseChannelMode(*channelName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	channelMode = mode
+
+	// A timeline may be written to the standard output, so progress goes
+	// to the standard error.
+	progress := os.Stdout
+	if *timeline {
+		progress = os.Stderr
+	}
+	fmt.Fprintf(progress, "Indexing db directory: '%s'\n", dbFolder)
+	db := loadDatabase(dbFolder)
 
 	info, err := os.Stat(inputPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if info.IsDir() {
-		_runBatchMode(inputPath, dbIndex, *outputFile)
-	} else {
-		runSingleMode(inputPath, dbIndex, *openYT)
+	opts := match.Options{Top: *top, FPR: *fpr, Speeds: match.Speeds(*speed, *speedStep), FreqTol: *freqTol}
+	switch {
+	case *timeline && info.IsDir():
+		log.Fatal("Timeline mode identifies a single recording, not a directory")
+	case *timeline:
+		runTimelineMode(inputPath, db, opts, *span, *hop, *format, *timelineFile)
+	case info.IsDir():
+		_runBatchMode(inputPath, db, opts, *outputFile)
+	default:
+		runSingleMode(inputPath, db, opts, *openYT)
 	}
 }
 
-func loadDatabase(path string) map[int][]IndexEntry {
-	invertedIndex := make(map[int][]IndexEntry)
-	files, _ := filepath.Glob(filepath.Join(path, "*.json"))
-
-	for _, file := range files {
-		f, _ := os.Open(file)
-		var fp FingerprintFile
-		json.NewDecoder(f).Decode(&fp)
-		f.Close()
-
-		for _, p := range fp.Points {
-			freq := int(p.FreqHz)
-			invertedIndex[freq] = append(invertedIndex[freq], IndexEntry{
-				SongName: fp.Filename,
-				TimeSec:  p.TimeSec,
-			})
+// loadDatabase opens the prebuilt index of the fingerprints in path. When
+// there is none, or it is out of date, the fingerprints are indexed in
+// memory instead: the first one decides the parameters of the database and
+// the ones that cannot be read or were made with incompatible parameters are
+// left out.
+func loadDatabase(path string) *database {
+	indexPath := filepath.Join(path, index.FileName)
+	idx, err := index.Open(indexPath)
+	switch {
+	case err == nil:
+		if stale := idx.Stale(path); stale != nil {
+			log.Printf("Index '%s' is out of date (%v), run 'audateci index build %s' to update it", indexPath, stale, path)
+			idx.Close()
+			break
 		}
+		return &database{Index: idx, Params: idx.Params()}
+	case !errors.Is(err, fs.ErrNotExist):
+		log.Printf("Cannot use index: %v", err)
 	}
 
-	return invertedIndex
+	scanned, skipped, err := index.Scan(path, defaultAnalysis())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, err := range skipped {
+		log.Printf("Skipping %v", err)
+	}
+	return &database{Index: scanned, Params: scanned.Params()}
 }
 
-func identifyAudio(path string, index map[int][]IndexEntry) (MatchResult, error) {
+// identifyAudio ranks the top songs of the database for the audio at path,
+// played back at any of the speeds of opts.
+func identifyAudio(path string, db *database, opts match.Options) (MatchResult, error) {
 	startTime := time.Now()
 
-	data, err := signal.ReadWavToFloats(path)
+	audio, err := streamKeypoints(path, db.queryParams())
 	if err != nil {
 		return MatchResult{}, err
 	}
-	samples := data.Channels[0]
+	queryHashes := audio.Hashes
 
-	var queryPoints []signal.KeyPoint
-	hopSize := windowSize / 2
-	for i := 0; i < len(samples)-windowSize; i += hopSize {
-		chunk := samples[i : i+windowSize]
-		fftRes := signal.FFT(signal.PadDataToPowerOfTwo(signal.ApplyHanningWindow(chunk)))
-		mags := signal.ComputeMagnitudes(fftRes)
-		t := float64(i) / float64(data.SampleRate)
-		peaks := signal.GetFingerprintPoints(mags, int(data.SampleRate), windowSize, t)
-		queryPoints = append(queryPoints, peaks...)
-	}
-
-	totalPoints := len(queryPoints)
+	totalPoints := len(queryHashes)
 	if totalPoints == 0 {
 		return MatchResult{QueryFile: filepath.Base(path), TotalPoints: 0}, nil
 	}
 
-	scores := make(map[string]map[int]int)
-	for _, p := range queryPoints {
-		freq := int(p.FreqHz)
-		if entries, found := index[freq]; found {
-			for _, entry := range entries {
-				offset := entry.TimeSec - p.TimeSec
-				offsetBin := int(math.Round(offset * 10))
-				if scores[entry.SongName] == nil {
-					scores[entry.SongName] = make(map[int]int)
-				}
-				scores[entry.SongName][offsetBin]++
-			}
-		}
+	res := MatchResult{
+		QueryFile:   filepath.Base(path),
+		TotalPoints: totalPoints,
+		Candidates:  match.RankSpeeds(audio.Points, audio.Params.Pairing(), db.Index, opts),
 	}
+	res.Alignment = alignAudio(path, res.Best(), audio.Params)
+	res.ProcessTime = time.Since(startTime)
+	return res, nil
+}
 
-	bestSong := "None"
-	bestOffset := 0.0
-	maxScore := 0
+// Alignment is where a query starts in a song, to the sample when the audio
+// of the song is at hand.
+type Alignment struct {
+	// Offset and Uncertainty, its standard error, are in seconds.
+	Offset      float64
+	Uncertainty float64
+	// Samples is Offset in samples at Rate.
+	Samples int64
+	Rate    int
+	// Waveform tells that the audio of the query and the song were cross
+	// correlated, rather than only their landmarks lined up.
+	Waveform bool
+}
 
-	for song, offsetMap := range scores {
-		for bin, count := range offsetMap {
-			scoreWithNeighbors := count
-			if v, ok := offsetMap[bin-1]; ok {
-				scoreWithNeighbors += v
-			}
-			if v, ok := offsetMap[bin+1]; ok {
-				scoreWithNeighbors += v
-			}
+func (a Alignment) String() string {
+	method := "landmarks"
+	if a.Waveform {
+		method = "waveform"
+	}
+	return fmt.Sprintf("%.4fs ± %.2gs, sample %d at %d Hz (%s)", a.Offset, a.Uncertainty, a.Samples, a.Rate, method)
+}
 
-			if scoreWithNeighbors > maxScore {
-				maxScore = scoreWithNeighbors
-				bestSong = song
-				bestOffset = float64(bin) / 10.0
-			}
+// landmarkAlignment is the offset of c as its landmarks line up, in samples
+// at rate.
+func landmarkAlignment(c match.Candidate, rate int) Alignment {
+	return Alignment{
+		Offset:      c.Offset,
+		Uncertainty: c.OffsetErr,
+		Samples:     int64(math.Round(c.Offset * float64(rate))),
+		Rate:        rate,
+	}
+}
+
+// minAlignCorrelation is the lowest normalized correlation the waveforms of a
+// query and a song are taken to be aligned at.
+const minAlignCorrelation = 0.2
+
+// alignAudio refines the offset of a matching candidate cross correlating the
+// audio of the query at path with the audio of its song, when the source of
+// the song is a local file, in samples at the rate of that file. Otherwise,
+// or if the waveforms do not line up, the offset is that of the landmarks.
+func alignAudio(path string, c match.Candidate, params fingerprint.Params) Alignment {
+	coarse := landmarkAlignment(c, params.SampleRate)
+	if !c.Match {
+		return coarse
+	}
+	if info, err := os.Stat(c.Song.Meta.Source); err != nil || !info.Mode().IsRegular() {
+		return coarse
+	}
+
+	lag, rate, err := alignExcerpts(path, c, params)
+	if err != nil {
+		log.Printf("Cannot align '%s' with the audio of '%s': %v", path, c.Song.Title(), err)
+		return coarse
+	}
+	if lag.corr < minAlignCorrelation || math.IsInf(lag.stdErr, 1) {
+		return coarse
+	}
+
+	// Interpolating the correlation peak is not exact to better than about
+	// a tenth of a sample, however clean the match.
+	return Alignment{
+		Offset:      lag.samples / float64(rate),
+		Uncertainty: max(lag.stdErr, 0.1) / float64(rate),
+		Samples:     int64(math.Round(lag.samples)),
+		Rate:        rate,
+		Waveform:    true,
+	}
+}
+
+type waveformLag struct {
+	samples, corr, stdErr float64
+}
+
+// alignExcerpts cross correlates up to 5s from the middle of the query with
+// the stretch of the song the landmark offset of c places them at, give or
+// take a few standard errors or a frame. Only those excerpts are decoded, so
+// aligning costs the same for any length of song or query. The lag is in
+// samples at the rate of the song.
+func alignExcerpts(path string, c match.Candidate, params fingerprint.Params) (waveformLag, int, error) {
+	ref, err := signal.OpenAudio(c.Song.Meta.Source)
+	if err != nil {
+		return waveformLag{}, 0, err
+	}
+	defer ref.Close()
+	query, err := signal.OpenAudio(path)
+	if err != nil {
+		return waveformLag{}, 0, err
+	}
+	defer query.Close()
+
+	// Played at speed s, the query has s times fewer samples per second of
+	// the song.
+	rate := ref.SampleRate()
+	from := int(math.Round(float64(query.SampleRate()) / c.Speed))
+	count, start := int64(5*from), int64(0)
+	if length := query.Length(); length >= 0 {
+		count = min(length, count)
+		start = (length - count) / 2
+	}
+	excerpt, err := readExcerpt(query, start, count)
+	if err != nil {
+		return waveformLag{}, 0, err
+	}
+	if from != rate {
+		if excerpt, err = signal.Resample(excerpt, from, rate); err != nil {
+			return waveformLag{}, 0, err
 		}
 	}
 
-	confidence := 0.0
-	if totalPoints > 0 {
-		confidence = (float64(maxScore) / float64(totalPoints))
+	// The excerpt starts skipped samples into the query and, by the
+	// landmarks, at guess in the song.
+	skipped := float64(start) * float64(rate) / float64(from)
+	guess := int64(math.Round(c.Offset*float64(rate) + skipped))
+	maxLag := int(math.Ceil(max(4*c.OffsetErr, params.Pairing().TimeStep) * float64(rate)))
+	lo := max(guess-int64(maxLag), 0)
+	song, err := readExcerpt(ref, lo, guess+int64(len(excerpt)+maxLag)-lo)
+	if err != nil {
+		return waveformLag{}, 0, err
 	}
 
-	return MatchResult{
-		QueryFile:   filepath.Base(path),
-		BestMatch:   filepath.Base(bestSong),
-		Offset:      bestOffset,
-		Score:       maxScore,
-		TotalPoints: totalPoints,
-		Confidence:  confidence,
-		ProcessTime: time.Since(startTime),
-	}, nil
+	lag, corr, stdErr := signal.Align(song, excerpt, int(guess-lo), maxLag)
+	return waveformLag{
+		samples: lag + float64(lo) - skipped,
+		corr:    corr,
+		stdErr:  stdErr,
+	}, rate, nil
 }
 
-func runSingleMode(file string, index map[int][]IndexEntry, openYT bool) {
+// readExcerpt decodes up to count frames of r from frame start on, mixed
+// down to mono. It returns fewer near the end of the stream.
+func readExcerpt(r signal.AudioReader, start, count int64) ([]float64, error) {
+	if length := r.Length(); length >= 0 && start >= length || count <= 0 {
+		return nil, nil
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	mixed, err := signal.MixReader(r, signal.DownmixChannels)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]float64, count)
+	n := 0
+	for n < len(samples) {
+		m, err := mixed.ReadSamples(samples[n:])
+		n += m
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return samples[:n], nil
+}
+
+func runSingleMode(file string, db *database, opts match.Options, openYT bool) {
 	fmt.Printf("Analyzing: %s\n", file)
-	res, err := identifyAudio(file, index)
+	res, err := identifyAudio(file, db, opts)
 	if err != nil {
 		log.Fatal(err)
 	}
+	best := res.Best()
 
-	songTitle := filepath.Base(res.BestMatch)
-	url, err := getVideoURL(songTitle)
+	songTitle := candidateTitle(best)
+	url, err := songURL(best.Song)
 	if err != nil {
 		fmt.Printf("Unnable to get url for best matching song: '%s'", songTitle)
 		url = "NONE"
@@ -189,18 +397,23 @@ func runSingleMode(file string, index map[int][]IndexEntry, openYT bool) {
 
 	fmt.Println("\nResults:")
 	fmt.Printf("   Match:      %s (%s)\n", songTitle, url)
-	fmt.Printf("   Offset:     %.1fs\n", res.Offset)
-	fmt.Printf("   Score:      %d / %d points\n", res.Score, res.TotalPoints)
-	fmt.Printf("   Confianza:  %.2f%%\n", res.Confidence)
+	printSongInfo(best.Song, "   ", 12)
+	fmt.Printf("   Offset:     %v\n", res.Alignment)
+	fmt.Printf("   Speed:      x%.3f\n", best.Speed)
+	fmt.Printf("   Score:      %.4g / %d hashes\n", best.Score, res.TotalPoints)
+	fmt.Printf("   Normalized: %.2f%% of the hashes (x%.1f the runner-up)\n", best.Normalized, best.Ratio)
+	fmt.Printf("   False alarm: %.2g\n", best.FalseAlarm)
 
 	fmt.Println("Verdict:")
 
-	if res.Confidence > ConfidenceThreshold && res.Score > 5 {
+	if best.Match {
 		fmt.Println("    Match found")
 	} else {
-		fmt.Println("    Unnable to find a match (Low confidence)")
+		fmt.Printf("    Unnable to find a match (false-alarm probability above %.2g)\n", opts.FPR)
 	}
 
+	printCandidates(res.Candidates, "   ")
+
 	if openYT {
 		err = openURL(url)
 		if err != nil {
@@ -209,6 +422,48 @@ func runSingleMode(file string, index map[int][]IndexEntry, openYT bool) {
 	}
 }
 
+// printCandidates lists the ranked candidates when there is more than one.
+func printCandidates(candidates []match.Candidate, indent string) {
+	if len(candidates) < 2 {
+		return
+	}
+	fmt.Println("Candidates:")
+	fmt.Printf("%s%-4s %-40s %9s %6s %7s %10s %7s %11s\n", indent, "#", "Song", "Offset", "Speed", "Score", "Normalized", "Ratio", "False alarm")
+	for i, c := range candidates {
+		fmt.Printf("%s%-4d %-40s %8.3fs %6.3f %7.4g %10.2f %6.1fx %11.2g\n", indent, i+1, candidateTitle(c), c.Offset, c.Speed, c.Score, c.Normalized, c.Ratio, c.FalseAlarm)
+	}
+}
+
+// printSongInfo prints the catalogue record of a matched song, after the
+// title already shown, with its labels padded to width.
+func printSongInfo(song index.Song, indent string, width int) {
+	if song.ID == 0 {
+		return
+	}
+	field := func(label string, value any) {
+		fmt.Printf("%s%-*s%v\n", indent, width, label+":", value)
+	}
+	field("Song ID", song.ID)
+	if song.Meta.Album != "" {
+		field("Album", song.Meta.Album)
+	}
+	if song.Duration > 0 {
+		field("Duration", time.Duration(song.Duration*float64(time.Second)).Round(time.Second))
+	}
+	if song.Meta.Source != "" {
+		field("Source", song.Meta.Source)
+	}
+}
+
+// songURL is the page of a matched song: its source when it was downloaded
+// from one, or else the first YouTube result for its title.
+func songURL(song index.Song) (string, error) {
+	if strings.HasPrefix(song.Meta.Source, "https://") || strings.HasPrefix(song.Meta.Source, "http://") {
+		return song.Meta.Source, nil
+	}
+	return getVideoURL(song.Title())
+}
+
 func getVideoURL(search string) (string, error) {
 	arg := fmt.Sprintf("ytsearch1:%s", search)
 	cmd := exec.Command("yt-dlp", "--print", "webpage_url", arg)
@@ -232,8 +487,8 @@ func openURL(url string) error {
 	return nil
 }
 
-func runBatchMode(folder string, index map[int][]IndexEntry, csvPath string) {
-	files, _ := filepath.Glob(filepath.Join(folder, "*.wav"))
+func runBatchMode(folder string, db *database, opts match.Options, csvPath string) {
+	files, _ := signal.GlobAudioFiles(folder)
 	fmt.Printf("Processing %d files in '%s'\n", len(files), folder)
 
 	csvFile, err := os.Create(csvPath)
@@ -245,40 +500,26 @@ func runBatchMode(folder string, index map[int][]IndexEntry, csvPath string) {
 	writer := csv.NewWriter(csvFile)
 	defer writer.Flush()
 
-	writer.Write([]string{"Query File", "Best Match", "Offset (s)", "Score", "Total Points", "Confidence %", "Time", "Status"})
+	writer.Write(reportHeader)
 
 	for i, file := range files {
 		fmt.Printf("[%d/%d] Processing %s ... ", i+1, len(files), filepath.Base(file))
 
-		res, err := identifyAudio(file, index)
+		res, err := identifyAudio(file, db, opts)
 		if err != nil {
 			fmt.Println("Error")
 			continue
 		}
 
-		status := "NO MATCH"
-		if res.Confidence > confidenceThreshold && res.Score > 5 {
-			status = "MATCH"
-		}
-
-		writer.Write([]string{
-			res.QueryFile,
-			res.BestMatch,
-			fmt.Sprintf("%.2f", res.Offset),
-			strconv.Itoa(res.Score),
-			strconv.Itoa(res.TotalPoints),
-			fmt.Sprintf("%.2f", res.Confidence),
-			res.ProcessTime.String(),
-			status,
-		})
-		fmt.Printf("Candidate: %s (Conf: %.2f%%)\n", res.BestMatch, res.Confidence)
+		writeReport(writer, res)
+		fmt.Printf("Candidate: %s (Normalized: %.2f)\n", candidateTitle(res.Best()), res.Best().Normalized)
 	}
 
 	fmt.Printf("\nReport saved to: %s\n", csvPath)
 }
 
-func _runBatchMode(folder string, index map[int][]IndexEntry, csvPath string) {
-	files, _ := filepath.Glob(filepath.Join(folder, "*.wav"))
+func _runBatchMode(folder string, db *database, opts match.Options, csvPath string) {
+	files, _ := signal.GlobAudioFiles(folder)
 	totalFiles := len(files)
 	fmt.Printf("Batch mode: processing %d files in '%s'\n", len(files), folder)
 
@@ -291,7 +532,7 @@ func _runBatchMode(folder string, index map[int][]IndexEntry, csvPath string) {
 
 	for range numWorkers {
 		wg.Add(1)
-		go worker(jobs, results, index, &wg)
+		go worker(jobs, results, db, opts, &wg)
 	}
 
 	for _, file := range files {
@@ -314,50 +555,73 @@ func _runBatchMode(folder string, index map[int][]IndexEntry, csvPath string) {
 	writer.Comma = ';'
 	defer writer.Flush()
 
-	writer.Write([]string{"Query File", "Best Match", "Offset (s)", "Score", "Total Points", "Confidence %", "Time", "Status"})
+	writer.Write(reportHeader)
 
 	count := 0
 	startTime := time.Now()
 
 	for res := range results {
 		count++
+		writeReport(writer, res)
+		printProgress(count, totalFiles, res.QueryFile, res.Status(), candidateTitle(res.Best()))
+	}
 
-		status := "NO MATCH"
-		if res.Confidence > ConfidenceThreshold && res.Score > 5 {
-			status = "MATCH"
-		} else if res.TotalPoints == 0 {
-			status = "ERROR"
-		}
+	fmt.Printf("\n\nProcessing finished in %v\n", time.Since(startTime))
+	fmt.Printf("Report saved to: %s\n", csvPath)
+}
+
+var reportHeader = []string{"Query File", "Rank", "Candidate", "Song ID", "Album", "Offset (s)", "Offset (samples)", "Sample Rate", "Offset Uncertainty (s)", "Speed", "Score", "Total Points", "Normalized Score", "Runner-up Ratio", "False Alarm", "Time", "Status"}
 
+// writeReport writes a row per candidate of res, only the first one carries
+// the verdict.
+func writeReport(writer *csv.Writer, res MatchResult) {
+	candidates := res.Candidates
+	if len(candidates) == 0 {
+		candidates = []match.Candidate{{}}
+	}
+	for i, c := range candidates {
+		status, alignment := "", landmarkAlignment(c, res.Alignment.Rate)
+		if i == 0 {
+			status, alignment = res.Status(), res.Alignment
+		}
 		writer.Write([]string{
 			res.QueryFile,
-			res.BestMatch,
-			fmt.Sprintf("%.2f", res.Offset),
-			strconv.Itoa(res.Score),
+			strconv.Itoa(i + 1),
+			candidateTitle(c),
+			songID(c.Song),
+			c.Song.Meta.Album,
+			fmt.Sprintf("%.6f", alignment.Offset),
+			strconv.FormatInt(alignment.Samples, 10),
+			strconv.Itoa(alignment.Rate),
+			fmt.Sprintf("%.2g", alignment.Uncertainty),
+			fmt.Sprintf("%.3f", c.Speed),
+			strconv.FormatFloat(c.Score, 'f', -1, 64),
 			strconv.Itoa(res.TotalPoints),
-			fmt.Sprintf("%.2f", res.Confidence),
+			fmt.Sprintf("%.2f", c.Normalized),
+			fmt.Sprintf("%.2f", c.Ratio),
+			fmt.Sprintf("%.3g", c.FalseAlarm),
 			res.ProcessTime.String(),
 			status,
 		})
-
-		printProgress(count, totalFiles, res.QueryFile, status, res.BestMatch)
 	}
+}
 
-	fmt.Printf("\n\nProcessing finished in %v\n", time.Since(startTime))
-	fmt.Printf("Report saved to: %s\n", csvPath)
+func songID(song index.Song) string {
+	if song.ID == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(song.ID), 10)
 }
 
-func worker(jobs <-chan string, results chan<- MatchResult, index map[int][]IndexEntry, wg *sync.WaitGroup) {
+func worker(jobs <-chan string, results chan<- MatchResult, db *database, opts match.Options, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for path := range jobs {
-		res, err := identifyAudio(path, index)
+		res, err := identifyAudio(path, db, opts)
 
 		if err != nil {
 			results <- MatchResult{
 				QueryFile: filepath.Base(path),
-				Score:     0,
-				BestMatch: "ERROR_READ",
 			}
 		} else {
 			res.QueryFile = filepath.Base(res.QueryFile)
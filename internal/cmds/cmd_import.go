@@ -2,7 +2,7 @@ package cmd
 
 import (
 	"bufio"
-	"encoding/json"
+	"cmp"
 	"flag"
 	"fmt"
 	"log"
@@ -12,12 +12,18 @@ import (
 	"strings"
 	"time"
 
+	"audateci/internal/fingerprint"
+	"audateci/internal/index"
 	signal "audateci/internal/signal"
 )
 
 func RunImportCmd(args []string) {
 	cmd := flag.NewFlagSet("import", flag.ExitOnError)
 	outputDir := cmd.String("o", "db", "Output directory for the fingerprints")
+	format := cmd.String("format", "json", "Fingerprint format: json or binary")
+	cmd.IntVar(&analysisRate, "rate", signal.AnalysisSampleRate, "Sample rate in Hz the audio is resampled to before analysis, 0 keeps each file's own rate")
+	addPeakFlags(cmd)
+	addBandFlags(cmd)
 	cmd.Parse(args)
 
 	if cmd.NArg() < 1 {
@@ -27,6 +33,11 @@ func RunImportCmd(args []string) {
 
 	inputFile := cmd.Arg(0)
 
+	ext, err := fingerprint.FormatExt(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	file, err := os.Open(inputFile)
 	if err != nil {
 		log.Fatalf("Unnable to open song-list-file: %v", err)
@@ -46,55 +57,77 @@ func RunImportCmd(args []string) {
 		fmt.Println("File is empty.")
 		return
 	}
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	mem := loadIndex(*outputDir)
+	params := databaseParams(mem)
 
 	for i, query := range songs {
 		safeFilename := sanitizeFilename(query)
-		jsonPath := filepath.Join(*outputDir, safeFilename+".json")
+		fpPath := filepath.Join(*outputDir, safeFilename+ext)
 
-		if _, err := os.Stat(jsonPath); err == nil {
+		if _, err := os.Stat(fpPath); err == nil {
 			fmt.Printf("[%d/%d] Skipping (already exists): %s\n", i+1, len(songs), query)
 			continue
 		}
 
 		fmt.Printf("[%d/%d] Processing: %s\n", i+1, len(songs), query)
 
-		tempWav := fmt.Sprintf("temp_%d.wav", i)
+		tempAudio := fmt.Sprintf("temp_%d.flac", i)
 
 		dlCmd := exec.Command("yt-dlp",
 			"ytsearch1:"+query,
 			"-x",
-			"--audio-format", "wav",
-			"-o", tempWav,
+			"--audio-format", "flac",
+			"--embed-metadata",
+			"--print", "after_move:webpage_url",
+			"-o", tempAudio,
 			"--force-overwrites",
 		)
 
-		if err := dlCmd.Run(); err != nil {
+		output, err := dlCmd.Output()
+		if err != nil {
 			fmt.Printf("   Error dowloading: %v\n", err)
 			continue
 		}
 
-		fingerprint := processAudioToFingerprint(tempWav, query)
+		fp := processAudioToFingerprint(tempAudio, query, params)
 
-		if len(fingerprint.Points) == 0 {
-			fmt.Printf("   Warninga: no audio data found in %s\n", tempWav)
-			os.Remove(tempWav)
+		if fp == nil || len(fp.Points) == 0 {
+			fmt.Printf("   Warninga: no audio data found in %s\n", tempAudio)
+			os.Remove(tempAudio)
 			continue
 		}
+		fp.ID = mem.NextID()
+		fp.Meta.Source = cmp.Or(strings.TrimSpace(string(output)), "ytsearch1:"+query)
+
+		if err := fingerprint.Save(fpPath, fp, false); err != nil {
+			fmt.Printf("   Error saving fingerprint: %v\n", err)
+		} else if err := mem.Add(fp, fpPath); err != nil {
+			log.Fatal(err)
+		} else {
+			fmt.Printf("   Fingerprint saved (%d points)\n", len(fp.Points))
+		}
 
-		jsonFile, _ := os.Create(jsonPath)
-		json.NewEncoder(jsonFile).Encode(fingerprint)
-		jsonFile.Close()
-
-		fmt.Printf("   Fingerprint saved (%d points)\n", len(fingerprint.Points))
-
-		os.Remove(tempWav)
+		os.Remove(tempAudio)
 
 		time.Sleep(2 * time.Second)
 	}
 
+	if err := mem.Write(filepath.Join(*outputDir, index.FileName)); err != nil {
+		log.Fatal(err)
+	}
 	fmt.Println("\nImport completed")
 }
 
+// songName names the song of an audio file after the file, without its
+// extension but keeping any other dots.
+func songName(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
 func sanitizeFilename(name string) string {
 	invalid := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|"}
 	for _, char := range invalid {
@@ -103,65 +136,78 @@ func sanitizeFilename(name string) string {
 	return name
 }
 
-func processAudioToFingerprint(wavPath, originalName string) FingerprintFile {
-	data, err := signal.ReadWavToFloats(wavPath)
+func processAudioToFingerprint(audioPath, originalName string, params fingerprint.Params) *fingerprint.File {
+	fp, err := fingerprintAudio(audioPath, originalName, params)
 	if err != nil {
-		log.Println("Error leyendo wav:", err)
-		return FingerprintFile{}
-	}
-	samples := data.Channels[0]
-
-	windowSize := 2048
-	hopSize := windowSize / 2
-	var points []signal.KeyPoint
-
-	for i := 0; i < len(samples)-windowSize; i += hopSize {
-		chunk := samples[i : i+windowSize]
-		fftRes := signal.FFT(signal.PadDataToPowerOfTwo(signal.ApplyHanningWindow(chunk)))
-		mags := signal.ComputeMagnitudes(fftRes)
-		t := float64(i) / float64(data.SampleRate)
-		peaks := signal.GetFingerprintPoints(mags, int(data.SampleRate), windowSize, t)
-		points = append(points, peaks...)
-	}
-
-	return FingerprintFile{
-		Filename: originalName,
-		Points:   points,
+		log.Println("Error reading audio:", err)
+		return nil
 	}
+	return fp
 }
 
 func RunFingerprintDir(args []string) {
 	cmd := flag.NewFlagSet("fpdir", flag.ExitOnError)
 	outputDir := cmd.String("o", "fdb", "Output directory for the fingerprints")
+	format := cmd.String("format", "json", "Fingerprint format: json or binary")
+	cmd.IntVar(&analysisRate, "rate", signal.AnalysisSampleRate, "Sample rate in Hz the audio is resampled to before analysis, 0 keeps each file's own rate")
+	addPeakFlags(cmd)
+	addBandFlags(cmd)
 	cmd.Parse(args)
 
 	if cmd.NArg() < 1 {
-		fmt.Println("Usage: audateci fpdir -o <output-dir> <dir-with-wavs>")
+		fmt.Println("Usage: audateci fpdir -o <output-dir> <dir-with-audio-files>")
 		os.Exit(1)
 	}
 
 	inputFolder := cmd.Arg(0)
 
-	files, _ := filepath.Glob(filepath.Join(inputFolder, "*.wav"))
+	ext, err := fingerprint.FormatExt(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	files, err := signal.GlobAudioFiles(inputFolder)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	mem := loadIndex(*outputDir)
+	params := databaseParams(mem)
 	totalFiles := len(files)
 	fmt.Printf("Processing %d files...\n", totalFiles)
 	for i, file := range files {
-		name := strings.SplitN(filepath.Base(file), ".", 2)[0]
+		name := songName(file)
 		fmt.Printf("[%d/%d] Processing '%s'...\n", i+1, totalFiles, name)
-		fpFile := processAudioToFingerprint(file, name)
+		fpFile := processAudioToFingerprint(file, name, params)
 
-		if len(fpFile.Points) == 0 {
+		if fpFile == nil || len(fpFile.Points) == 0 {
 			fmt.Printf("Warning: no audio data found in %s\n", file)
 			continue
 		}
-
-		outputFile := filepath.Join(*outputDir, sanitizeFilename(name)+".json")
-		jsonFile, _ := os.Create(outputFile)
-		json.NewEncoder(jsonFile).Encode(fpFile)
-		jsonFile.Close()
+		outputFile := filepath.Join(*outputDir, sanitizeFilename(name)+ext)
+		// A song fingerprinted again keeps its ID.
+		fpFile.ID = mem.NextID()
+		for _, song := range mem.Songs() {
+			if song.File == filepath.Base(outputFile) {
+				fpFile.ID = song.ID
+			}
+		}
+		if err := fingerprint.Save(outputFile, fpFile, false); err != nil {
+			fmt.Printf("Error saving fingerprint: %v\n", err)
+			continue
+		}
+		mem.RemoveFile(filepath.Base(outputFile))
+		if err := mem.Add(fpFile, outputFile); err != nil {
+			log.Fatal(err)
+		}
 
 		fmt.Printf("Fingerprint saved to '%s' (%d points)\n", outputFile, len(fpFile.Points))
 	}
 
+	if err := mem.Write(filepath.Join(*outputDir, index.FileName)); err != nil {
+		log.Fatal(err)
+	}
 	fmt.Println("Process finished successfully")
 }
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"audateci/internal/index"
+	signal "audateci/internal/signal"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func RunIndexCmd(args []string) {
+	if len(args) < 1 || args[0] != "build" {
+		fmt.Println("Usage: audateci index build [options] <directory-with-fingerprints>")
+		os.Exit(1)
+	}
+
+	cmd := flag.NewFlagSet("index build", flag.ExitOnError)
+	cmd.IntVar(&windowSize, "winsize", 2048, "Size of the FFT window assumed for fingerprints older than version 3")
+	cmd.IntVar(&analysisRate, "rate", signal.AnalysisSampleRate, "Sample rate in Hz assumed for fingerprints older than version 3")
+
+	cmd.Parse(args[1:])
+
+	if cmd.NArg() < 1 {
+		fmt.Println("Error. Missing fingerprint directory")
+		fmt.Println("Usage: audateci index build [options] <directory-with-fingerprints>")
+		fmt.Println("Available options are:")
+		cmd.PrintDefaults()
+		os.Exit(1)
+	}
+	dbFolder := cmd.Arg(0)
+	output := filepath.Join(dbFolder, index.FileName)
+
+	startTime := time.Now()
+	idx, skipped, err := index.Scan(dbFolder, defaultAnalysis())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, err := range skipped {
+		log.Printf("Skipping %v", err)
+	}
+
+	if err := idx.Write(output); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Indexed %d fingerprints into '%s' in %v\n", len(idx.Songs()), output, time.Since(startTime))
+}
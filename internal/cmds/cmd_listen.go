@@ -12,55 +12,63 @@ import (
 
 	"github.com/gopxl/beep/v2"
 	"github.com/gopxl/beep/v2/speaker"
-	"github.com/gopxl/beep/v2/wav"
 )
 
 func RunListenCmd(args []string) {
 	cmd := flag.NewFlagSet("listen", flag.ExitOnError)
 
 	bars := cmd.Int("bars", 20, "Number of frquency bars to show")
-	winSize := cmd.Int("winsize", 4096, "Window size used for fft, must be a power of two")
+	winSize := cmd.Int("winsize", 4096, "Window size used for fft, in samples")
+	windowName := cmd.String("window", "hann", "Analysis window: "+signal.WindowNames())
+	channelName := cmd.String("channel", "mix", "Channels shown by the visualizer, 'all' shows one spectrum per channel: "+signal.ChannelModeNames())
 
 	cmd.Parse(args)
 
 	if cmd.NArg() < 1 {
 		fmt.Println("Error. Missing audio file")
-		fmt.Println("Usage: audateci listen [options] <audio_file.wav>")
+		fmt.Println("Usage: audateci listen [options] <audio-file>")
 		fmt.Println("Available options are:")
 		cmd.PrintDefaults()
 		os.Exit(1)
 	}
 	inputFile := cmd.Arg(0)
 
-	f, err := os.Open(inputFile)
+	window, err := signal.ParseWindow(*windowName)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	streamer, format, err := wav.Decode(f)
+	channels, err := signal.ParseChannelMode(*channelName)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer streamer.Close()
-
-	speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
-
-	ctrl := &beep.Ctrl{Streamer: streamer, Paused: false}
 
-	data, err := signal.ReadWavToFloats(inputFile)
+	data, err := signal.ReadAudio(inputFile)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	playbackRate := beep.SampleRate(data.SampleRate)
+	speaker.Init(playbackRate, playbackRate.N(time.Second/10))
+
+	ctrl := &beep.Ctrl{Streamer: newAudioStreamer(data), Paused: false}
+
 	windowSize := *winSize
 	sampleRate := data.SampleRate
-	samples := data.Channels[0]
+	signals, err := data.Select(channels)
+	if err != nil {
+		log.Fatal(err)
+	}
+	labels := channels.Split(len(data.Channels))
+	samples := signals[0]
+	stft := signal.NewSTFT(windowSize, windowSize/2)
+	stft.Window = window
 
 	fmt.Printf("File '%s' read successfully\n", inputFile)
 	fmt.Printf("Sample frequency: %d Hz \n", sampleRate)
-	fmt.Printf("Channels: %d\n", len(data.Channels))
+	fmt.Printf("Channels: %d (showing %s)\n", len(data.Channels), channels)
 	fmt.Printf("Samples per channel: %d\n", len(samples))
 	fmt.Printf("Window size for FFT: %d\n", windowSize)
+	fmt.Printf("Window function: %s\n", window.Name)
 
 	keyboardChan := make(chan bool)
 	go func() {
@@ -115,18 +123,43 @@ func RunListenCmd(args []string) {
 				return
 			}
 
-			chunk := samples[sampleIdx : sampleIdx+windowSize]
-			windowedChunk := signal.ApplyHanningWindow(chunk)
-			complexInput := signal.PadDataToPowerOfTwo(windowedChunk)
-			fftResult := signal.FFT(complexInput)
-			magnitudes := signal.ComputeMagnitudes(fftResult)
-
 			fmt.Print("\033c\033[3J")
 
-			draw.DrawLogSpectrum(magnitudes, sampleRate, *bars)
+			for i, channel := range signals {
+				if len(signals) > 1 {
+					fmt.Printf("\n[%s]", labels[i])
+				}
+				frame := stft.FrameAt(channel, sampleIdx, sampleRate)
+				draw.DrawLogSpectrum(frame.Magnitudes, sampleRate, *bars)
+			}
 
 			percent := float64(sampleIdx) / float64(len(samples)) * 100
 			fmt.Printf("\n\n %.1f%% - %.1f/%.1fs\n", percent, elapsed.Seconds(), float64(len(samples))/float64(sampleRate))
 		}
 	}
 }
+
+// newAudioStreamer plays decoded samples through beep, so the file is only
+// decoded once. Mono files are sent to both speakers.
+func newAudioStreamer(data *signal.AudioData) beep.Streamer {
+	left := data.Channels[0]
+	right := left
+	if len(data.Channels) > 1 {
+		right = data.Channels[1]
+	}
+
+	pos := 0
+	return beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		if pos >= len(left) {
+			return 0, false
+		}
+
+		n := min(len(samples), len(left)-pos)
+		for i := range n {
+			samples[i][0] = left[pos+i]
+			samples[i][1] = right[pos+i]
+		}
+		pos += n
+		return n, true
+	})
+}
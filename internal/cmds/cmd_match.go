@@ -1,20 +1,24 @@
 package cmd
 
 import (
+	"audateci/internal/fingerprint"
+	"audateci/internal/index"
+	"audateci/internal/match"
+	"audateci/internal/signal"
+	"cmp"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
-	"math"
 	"os"
 	"sort"
 )
 
-const DecisionThreshold = 2000
-
 func RunMatchCmd(args []string) {
 	cmd := flag.NewFlagSet("match", flag.ExitOnError)
-	threshold := cmd.Int("th", 100, "Threshold used for match decision ")
+	fpr := cmd.Float64("fpr", match.DefaultFPR, "Target false-positive rate: highest false-alarm probability accepted as a match")
+	speed := cmd.Float64("speed", 0, "Also search playback speeds up to this much faster or slower, 0.06 for ±6%")
+	freqTol := cmd.Int("ftol", 0, "Number of frequency bins peaks may be off by, with less weight, to tolerate detuned or resampled recordings")
 	debug := cmd.Bool("d", false, "debug only")
 
 	cmd.Parse(args)
@@ -30,86 +34,66 @@ func RunMatchCmd(args []string) {
 
 	refData := loadFingerprint(refPath)
 	sampleData := loadFingerprint(samplePath)
+	if err := sampleData.Params.Compatible(refData.Params); err != nil {
+		log.Fatalf("Fingerprints cannot be compared: %v", err)
+	}
 
-	fmt.Printf(
-		"Comparing:\n   Reference: %s, (%d keypoints)\n   Sample:    %s, (%d keypoints)",
-		refPath, len(refData.Points), samplePath, len(sampleData.Points))
+	refHashes := refData.Hashes
+	sampleHashes := sampleData.Hashes
 
-	refIndex := make(map[int][]float64)
-	for _, p := range refData.Points {
-		freq := int(p.FreqHz)
-		refIndex[freq] = append(refIndex[freq], p.TimeSec)
-	}
+	fmt.Printf(
+		"Comparing:\n   Reference: %s, (%d keypoints, %d hashes)\n   Sample:    %s, (%d keypoints, %d hashes)",
+		refPath, len(refData.Points), len(refHashes), samplePath, len(sampleData.Points), len(sampleHashes))
 
-	offsetHistogram := make(map[int]int)
-	for _, pSample := range sampleData.Points {
-		freq := int(pSample.FreqHz)
-		timesRef, found := refIndex[freq]
-		if found {
-			for _, tRef := range timesRef {
-				offset := tRef - pSample.TimeSec
-				offsetBin := int(math.Round(offset * 10))
-				offsetHistogram[offsetBin]++
-			}
-		}
+	// The reference is the only song of an index, so that the sample is
+	// judged by the same null model as identify.
+	refIndex := index.NewMemory(refData.Params)
+	if err := refIndex.Add(refData, refPath); err != nil {
+		log.Fatal(err)
 	}
-
-	bestOffsetBin := 0
-	bestScore := 0
-	for bin, score := range offsetHistogram {
-		neighborsScore := score
-		if bin > 0 {
-			neighborsScore += offsetHistogram[bin-1]
-		}
-		if bin < len(offsetHistogram)-1 {
-			neighborsScore += offsetHistogram[bin+1]
-		}
-		if neighborsScore > bestScore {
-			bestOffsetBin = bin
-			bestScore = neighborsScore
-		}
+	best := match.Candidate{}
+	opts := match.Options{Top: 1, FPR: *fpr, Speeds: match.Speeds(*speed, 0.01), FreqTol: *freqTol}
+	if ranked := match.RankSpeeds(sampleData.Points, sampleData.Params.Pairing(), refIndex, opts); len(ranked) > 0 {
+		best = ranked[0]
 	}
 
-	predictedOffset := float64(bestOffsetBin) / 10.0
-
 	fmt.Println("\nAnalysis results:")
-	fmt.Printf("   Maximum score:    %d matches\n", bestScore)
-	fmt.Printf("   Estimated offset: %.1f seconds\n", predictedOffset)
+	fmt.Printf("   Maximum score:    %.4g matches\n", best.Score)
+	alignment := landmarkAlignment(best, sampleData.Params.SampleRate)
+	if sampleData.Meta.Source != "" {
+		alignment = alignAudio(sampleData.Meta.Source, best, sampleData.Params)
+	}
+	fmt.Printf("   Estimated offset: %v\n", alignment)
+	fmt.Printf("   Playback speed:   x%.3f\n", best.Speed)
+	fmt.Printf("   False alarm:      %.2g\n", best.FalseAlarm)
 
-	conf := float64(bestScore)
-	if conf > float64(*threshold) {
+	if best.Match {
 		fmt.Println("Results:")
 		fmt.Println("   Match detected!")
-		fmt.Printf("   The sample appears to be a fragment of the reference audio, starting at second %.1f", predictedOffset)
+		fmt.Printf("   The sample appears to be a fragment of the reference audio, starting at second %.4f\n", alignment.Offset)
 	} else {
-		fmt.Println("   Sample did not match with the reference")
+		fmt.Printf("   Sample did not match with the reference (false-alarm probability above %.2g)\n", *fpr)
 	}
 
 	if *debug {
-		exportHistogram(offsetHistogram)
+		// The histogram of the speed the sample matches best at.
+		aligned := signal.GetLandmarks(match.AtSpeed(sampleData.Points, cmp.Or(best.Speed, 1)), sampleData.Params.Pairing())
+		exportHistogram(match.Histogram(aligned, refIndex, *freqTol)[best.Song.ID])
 	}
 }
 
-func loadFingerprint(path string) AudioFingerprint {
-	f, err := os.Open(path)
+func loadFingerprint(path string) *fingerprint.File {
+	data, err := fingerprint.Load(path, defaultAnalysis())
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer f.Close()
-
-	var data AudioFingerprint
-	jsonerr := json.NewDecoder(f).Decode(&data)
-	if jsonerr != nil {
-		log.Fatal("Error decoding JSON: ", err)
-	}
-
 	return data
 }
 
-func exportHistogram(histogram map[int]int) {
+func exportHistogram(histogram map[int]float64) {
 	type Bin struct {
 		Offset float64 `json:"offset"`
-		Count  int     `json:"count"`
+		Count  float64 `json:"count"`
 	}
 
 	var data []Bin
@@ -1,28 +1,35 @@
 package cmd
 
 import (
+	"audateci/internal/fingerprint"
+	"audateci/internal/match"
 	"audateci/internal/signal"
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"log"
-	"math"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-const confidenceThreshold = 5.0
-
 type Session struct {
 	TargetFile   string
 	Points       []signal.KeyPoint
-	SampleRate   int
+	Landmarks    []signal.Landmark
+	Params       fingerprint.Params
 	IsReady      bool
 	AnalysisTime time.Duration
-	mu           sync.Mutex
+	// DBParams are the parameters of the last database searched, the next
+	// files loaded are analyzed with them.
+	DBParams *fingerprint.Params
+	// db is the last database opened, kept for as long as identify is asked
+	// to search the same directory.
+	db       *database
+	dbFolder string
+	mu       sync.Mutex
 }
 
 func RunReplCmd() {
@@ -86,30 +93,21 @@ func RunReplCmd() {
 func processAudioBackground(s *Session) {
 	s.mu.Lock()
 	processingFile := s.TargetFile
+	params := defaultAnalysis()
+	if s.DBParams != nil {
+		params = *s.DBParams
+		params.Channels = channelMode.String()
+	}
 	s.mu.Unlock()
 
 	startTime := time.Now()
 
-	data, err := signal.ReadWavToFloats(s.TargetFile)
+	audio, err := streamKeypoints(processingFile, params)
 	if err != nil {
 		log.Printf("\nError reading audio file in the background: %v\n>>> ", err)
+		return
 	}
-	samples := data.Channels[0]
-
-	windowSize := 2048
-	hopSize := windowSize / 2
-	var foundPoints []signal.KeyPoint
-
-	for i := 0; i < len(samples)-windowSize; i += hopSize {
-		chunk := samples[i : i+windowSize]
-		windowed := signal.ApplyHanningWindow(chunk)
-		padded := signal.PadDataToPowerOfTwo(windowed)
-		fftRes := signal.FFT(padded)
-		mags := signal.ComputeMagnitudes(fftRes)
-		time := float64(i) / float64(data.SampleRate)
-		peaks := signal.GetFingerprintPoints(mags, data.SampleRate, windowSize, time)
-		foundPoints = append(foundPoints, peaks...)
-	}
+	foundPoints := audio.Points
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -119,7 +117,8 @@ func processAudioBackground(s *Session) {
 	}
 
 	s.Points = foundPoints
-	s.SampleRate = data.SampleRate
+	s.Landmarks = audio.Hashes
+	s.Params = audio.Params
 	s.IsReady = true
 	s.AnalysisTime = time.Since(startTime)
 
@@ -129,7 +128,7 @@ func processAudioBackground(s *Session) {
 
 func handleLoad(s *Session, args []string) {
 	if len(args) < 1 {
-		fmt.Println("Usage: load <audio-file.wav>")
+		fmt.Println("Usage: load <audio-file>")
 		return
 	}
 
@@ -144,6 +143,7 @@ func handleLoad(s *Session, args []string) {
 	s.mu.Lock()
 	s.TargetFile = path
 	s.Points = nil
+	s.Landmarks = nil
 	s.IsReady = false
 	s.mu.Unlock()
 
@@ -172,92 +172,112 @@ func handleIdentify(s *Session, args []string) {
 		return
 	}
 
+	landmarks := s.Landmarks
 	points := s.Points
+	file := s.TargetFile
+	params := s.Params
 	s.mu.Unlock()
 
+	if len(landmarks) == 0 {
+		fmt.Println("The loaded audio has no landmarks to look up, try with a longer fragment")
+		return
+	}
+
 	if len(args) < 1 {
-		fmt.Println("Usage: identify <dir-with-fingerprints>")
+		fmt.Println("Usage: identify <dir-with-fingerprints> [candidates] [false-positive rate] [speed range]")
 		return
 	}
 	dbFolder := args[0]
+	top := 3
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			fmt.Printf("Invalid number of candidates '%s'\n", args[1])
+			return
+		}
+		top = n
+	}
+	fpr := match.DefaultFPR
+	if len(args) > 2 {
+		rate, err := strconv.ParseFloat(args[2], 64)
+		if err != nil || rate <= 0 || rate >= 1 {
+			fmt.Printf("Invalid false-positive rate '%s'\n", args[2])
+			return
+		}
+		fpr = rate
+	}
+	speeds := match.Speeds(0, 0)
+	if len(args) > 3 {
+		span, err := strconv.ParseFloat(args[3], 64)
+		if err != nil || span < 0 || span >= 0.5 {
+			fmt.Printf("Invalid speed range '%s'\n", args[3])
+			return
+		}
+		speeds = match.Speeds(span, 0.01)
+	}
 
 	fmt.Println("Looking for matches in the data base...")
 
-	dbIndex := make(map[int][]IndexEntry)
-	files, err := filepath.Glob(filepath.Join(dbFolder, "*.json"))
+	files, err := fingerprint.Glob(dbFolder)
 	if err != nil || len(files) == 0 {
-		fmt.Println("No fingerprints (.json) found in the directory")
+		fmt.Println("No fingerprints (.json or .afp) found in the directory")
 		return
 	}
-
-	for _, file := range files {
-		f, _ := os.Open(file)
-		var fingerprint FingerprintFile
-		json.NewDecoder(f).Decode(&fingerprint)
-		f.Close()
-		for _, p := range fingerprint.Points {
-			freq := int(p.FreqHz)
-			dbIndex[freq] = append(dbIndex[freq], IndexEntry{SongName: fingerprint.Filename, TimeSec: p.TimeSec})
-		}
-	}
-
-	scores := make(map[string]map[int]int)
-	for _, pFrag := range points {
-		freq := int(pFrag.FreqHz)
-		if entries, found := dbIndex[freq]; found {
-			for _, entry := range entries {
-				offset := entry.TimeSec - pFrag.TimeSec
-				offsetBin := int(math.Round(offset * 10))
-				if scores[entry.SongName] == nil {
-					scores[entry.SongName] = make(map[int]int)
-				}
-				scores[entry.SongName][offsetBin]++
-			}
-		}
+	db := s.openDatabase(dbFolder)
+	if err := params.Compatible(db.Params); err != nil {
+		s.mu.Lock()
+		s.DBParams = &db.Params
+		s.mu.Unlock()
+		fmt.Printf("The loaded audio cannot be compared with these fingerprints (%v). Load it again to analyze it like the database\n", err)
+		return
 	}
 
-	bestSong := ""
-	bestOffset := 0.0
-	bestScore := 0
-	// secondBestScore := 0
-
-	for song, offsetMap := range scores {
-		for bin, count := range offsetMap {
-			neighborsScore := count
-			if v, ok := offsetMap[bin-1]; ok {
-				neighborsScore += v
-			}
-			if v, ok := offsetMap[bin-1]; ok {
-				neighborsScore += v
-			}
-
-			if neighborsScore > bestScore {
-				// secondBestScore = bestScore
-				bestSong = song
-				bestOffset = float64(bin) / 10.0
-				bestScore = neighborsScore
-			}
-		}
+	candidates := match.RankSpeeds(points, params.Pairing(), db.Index, match.Options{Top: top, FPR: fpr, Speeds: speeds})
+	best := match.Candidate{}
+	if len(candidates) > 0 {
+		best = candidates[0]
 	}
 
-	confPercentage := float64(bestScore) / float64(len(points)) * 100.0
-
 	fmt.Println("Results:")
-	fmt.Printf("   Song:            %s\n", filepath.Base(bestSong))
-	fmt.Printf("   Offset:          %.1fs\n", bestOffset)
-	fmt.Printf("   Absolute score:  %d matches\n", bestScore)
-	fmt.Printf("   Confidence:      %.2f%%\n", confPercentage)
-
-	if confPercentage > confidenceThreshold {
+	fmt.Printf("   Song:            %s\n", candidateTitle(best))
+	printSongInfo(best.Song, "   ", 17)
+	fmt.Printf("   Offset:          %v\n", alignAudio(file, best, params))
+	fmt.Printf("   Speed:           x%.3f\n", best.Speed)
+	fmt.Printf("   Absolute score:  %.4g / %d matches\n", best.Score, len(landmarks))
+	fmt.Printf("   Normalized:      %.2f%% of the hashes (x%.1f the runner-up)\n", best.Normalized, best.Ratio)
+	fmt.Printf("   False alarm:     %.2g\n", best.FalseAlarm)
+
+	if best.Match {
 		fmt.Println("Match found!")
 	} else {
-		fmt.Println("Confidence percentage below minimum threshold (5%). try again with a larger or cleaner fragment")
+		fmt.Printf("False-alarm probability above %.2g, try again with a larger or cleaner fragment\n", fpr)
+	}
+	printCandidates(candidates, "   ")
+}
+
+func (s *Session) openDatabase(folder string) *database {
+	s.mu.Lock()
+	db, cached := s.db, s.dbFolder
+	s.mu.Unlock()
+	if db != nil && cached == folder {
+		return db
+	}
+
+	if db != nil {
+		db.Index.Close()
 	}
+	db = loadDatabase(folder)
+
+	s.mu.Lock()
+	s.db, s.dbFolder = db, folder
+	s.mu.Unlock()
+	return db
 }
+
 func printReplHelp() {
 	fmt.Println("Available commands:")
-	fmt.Println("    identify <directory>       Compare loaded audio with all the fingerprints contained in <dir>")
-	fmt.Println("    load     <audio-file.wav>  Load a new audio file")
-	fmt.Println("    status                     Check the status of the analysis running in the background")
-	fmt.Println("    exit                       Exit the program")
+	fmt.Println("    identify <dir> [n] [fpr] [speed]   Compare loaded audio with all the fingerprints contained in <dir>, listing the n best candidates, matches accepted at a false-positive rate fpr, also played up to speed (0.06 for ±6%) faster or slower")
+	fmt.Println("    load     <audio-file>              Load a new audio file")
+	fmt.Println("    status                             Check the status of the analysis running in the background")
+	fmt.Println("    exit                               Exit the program")
 }
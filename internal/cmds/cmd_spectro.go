@@ -7,6 +7,8 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
 func RunSpectroCmd(args []string) {
@@ -14,40 +16,73 @@ func RunSpectroCmd(args []string) {
 
 	outputImg := cmd.String("o", "spectrogram.png", "Name of the output image")
 	pyScript := cmd.String("script", "./internal/spectrogram/spectro.py", "Path to the python script for visualization")
-	windowSize := cmd.Int("winsize", 4096, "Size of the window used for FFT (must be a power of two)")
+	windowSize := cmd.Int("winsize", 4096, "Size of the window used for FFT, in samples")
+	windowName := cmd.String("window", "hann", "Analysis window: "+signal.WindowNames())
+	channelName := cmd.String("channel", "mix", "Channels to analyze, 'all' draws one image per channel: "+signal.ChannelModeNames())
 
 	cmd.Parse(args)
 
 	if cmd.NArg() < 1 {
 		fmt.Println("Error. Missing audio file")
-		fmt.Println("Usage: audateci spectro [options] <audio_file.wav>")
+		fmt.Println("Usage: audateci spectro [options] <audio-file>")
 		fmt.Println("Available options are:")
 		cmd.PrintDefaults()
 		os.Exit(1)
 	}
 	audioPath := cmd.Arg(0)
 
+	window, err := signal.ParseWindow(*windowName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	channels, err := signal.ParseChannelMode(*channelName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Processing audio from: %s\n", audioPath)
+
+	if channels.Kind != signal.ChannelAll {
+		drawSpectrogram(audioPath, *outputImg, *pyScript, *windowSize, window, channels)
+		return
+	}
+
+	audio, err := signal.OpenAudio(audioPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	numChannels := audio.Channels()
+	audio.Close()
+
+	ext := filepath.Ext(*outputImg)
+	for _, mode := range channels.Split(numChannels) {
+		output := fmt.Sprintf("%s_%s%s", strings.TrimSuffix(*outputImg, ext), mode, ext)
+		drawSpectrogram(audioPath, output, *pyScript, *windowSize, window, mode)
+	}
+}
+
+func drawSpectrogram(audioPath, outputImg, pyScript string, windowSize int, window signal.Window, channels signal.ChannelMode) {
 	tempCSV, err := os.CreateTemp("", "spectro_data_*.csv")
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer os.Remove(tempCSV.Name())
 
-	fmt.Printf("Processing audio from: %s\n", audioPath)
 	fmt.Printf("Generating intermediate files in: %s\n", tempCSV.Name())
 
-	signal.GenerateCSV(audioPath, tempCSV, *windowSize)
+	signal.GenerateCSV(audioPath, tempCSV, windowSize, window, channels)
 
 	tempCSV.Close()
 
-	fmt.Printf("Executing python script for visualization: %s\n", *pyScript)
+	fmt.Printf("Executing python script for visualization: %s\n", pyScript)
 
-	pythonCmd := exec.Command("python3", *pyScript, tempCSV.Name(), "--save", *outputImg)
+	pythonCmd := exec.Command("python3", pyScript, tempCSV.Name(), "--save", outputImg)
 	pythonCmd.Stdout = os.Stdout
 	pythonCmd.Stderr = os.Stderr
 
 	pyerr := pythonCmd.Run()
 	if pyerr != nil {
-		log.Fatalf("Error during execution of python script: %v\n", *pyScript)
+		log.Fatalf("Error during execution of python script: %v\n", pyScript)
 	}
 }
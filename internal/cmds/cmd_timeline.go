@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"audateci/internal/match"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// unidentified is the title of the stretches no song was identified in.
+const unidentified = "Unidentified"
+
+// runTimelineMode identifies the songs playing along a long recording and
+// writes them as a cue sheet, csv or json to out, or to the standard output
+// when out is empty. Every span seconds of the recording are identified on
+// their own, starting every hop seconds.
+func runTimelineMode(file string, db *database, opts match.Options, span, hop float64, format, out string) {
+	if span <= 0 || hop <= 0 {
+		log.Fatal("The span and hop of the timeline must be positive")
+	}
+	write, ok := map[string]func(io.Writer, string, []match.Segment) error{
+		"cue":  writeCue,
+		"csv":  writeTimelineCSV,
+		"json": writeTimelineJSON,
+	}[format]
+	if !ok {
+		log.Fatalf("Unknown timeline format '%s', use cue, csv or json", format)
+	}
+
+	fmt.Fprintf(os.Stderr, "Analyzing: %s\n", file)
+	audio, err := streamKeypoints(file, db.queryParams())
+	if err != nil {
+		log.Fatal(err)
+	}
+	segments := match.Timeline(audio.Points, audio.Duration, audio.Params.Pairing(), db.Index, opts, span, hop)
+
+	w := io.Writer(os.Stdout)
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(w, file, segments); err != nil {
+		log.Fatal(err)
+	}
+
+	identified := 0
+	for _, s := range segments {
+		if s.Identified {
+			identified++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d segments, %d identified\n", len(segments), identified)
+	if out != "" {
+		fmt.Fprintf(os.Stderr, "Timeline saved to: %s\n", out)
+	}
+}
+
+func segmentTitle(s match.Segment) string {
+	if !s.Identified {
+		return unidentified
+	}
+	return cmp.Or(s.Song.Meta.Title, s.Song.Name)
+}
+
+// writeCue writes a cue sheet with a track per segment. Cue sheets count time
+// in frames of 1/75s.
+func writeCue(w io.Writer, file string, segments []match.Segment) error {
+	fileType := "WAVE"
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".aif", ".aiff":
+		fileType = "AIFF"
+	case ".mp3":
+		fileType = "MP3"
+	}
+	quote := func(s string) string { return `"` + strings.ReplaceAll(s, `"`, "'") + `"` }
+
+	fmt.Fprintf(w, "TITLE %s\n", quote(filepath.Base(file)))
+	fmt.Fprintf(w, "FILE %s %s\n", quote(filepath.Base(file)), fileType)
+	for i, s := range segments {
+		fmt.Fprintf(w, "  TRACK %02d AUDIO\n", i+1)
+		fmt.Fprintf(w, "    TITLE %s\n", quote(segmentTitle(s)))
+		if s.Identified {
+			if s.Song.Meta.Artist != "" {
+				fmt.Fprintf(w, "    PERFORMER %s\n", quote(s.Song.Meta.Artist))
+			}
+			fmt.Fprintf(w, "    REM SONG_ID %d\n", s.Song.ID)
+			fmt.Fprintf(w, "    REM OFFSET %.3f\n", s.Offset)
+			fmt.Fprintf(w, "    REM SPEED %.3f\n", s.Speed)
+			fmt.Fprintf(w, "    REM SCORE %g\n", s.Score)
+		}
+		frames := int(math.Round(s.Start * 75))
+		fmt.Fprintf(w, "    INDEX 01 %02d:%02d:%02d\n", frames/75/60, frames/75%60, frames%75)
+	}
+	return nil
+}
+
+var timelineHeader = []string{"Start (s)", "End (s)", "Status", "Song", "Song ID", "Offset (s)", "Speed", "Score", "False Alarm"}
+
+func writeTimelineCSV(w io.Writer, _ string, segments []match.Segment) error {
+	writer := csv.NewWriter(w)
+	writer.Write(timelineHeader)
+	for _, s := range segments {
+		row := []string{fmt.Sprintf("%.2f", s.Start), fmt.Sprintf("%.2f", s.End), "UNIDENTIFIED", unidentified, "", "", "", "", ""}
+		if s.Identified {
+			row = append(row[:2],
+				"MATCH",
+				s.Song.Title(),
+				songID(s.Song),
+				fmt.Sprintf("%.3f", s.Offset),
+				fmt.Sprintf("%.3f", s.Speed),
+				strconv.FormatFloat(s.Score, 'f', -1, 64),
+				fmt.Sprintf("%.3g", s.FalseAlarm),
+			)
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeTimelineJSON(w io.Writer, file string, segments []match.Segment) error {
+	type song struct {
+		ID         uint32  `json:"id"`
+		Title      string  `json:"title"`
+		Offset     float64 `json:"offset"`
+		Speed      float64 `json:"speed"`
+		Score      float64 `json:"score"`
+		FalseAlarm float64 `json:"false_alarm"`
+	}
+	type segment struct {
+		Start      float64 `json:"start"`
+		End        float64 `json:"end"`
+		Identified bool    `json:"identified"`
+		Song       *song   `json:"song,omitempty"`
+	}
+	timeline := struct {
+		File     string    `json:"file"`
+		Segments []segment `json:"segments"`
+	}{File: filepath.Base(file), Segments: make([]segment, 0, len(segments))}
+
+	for _, s := range segments {
+		seg := segment{Start: s.Start, End: s.End, Identified: s.Identified}
+		if s.Identified {
+			seg.Song = &song{ID: s.Song.ID, Title: s.Song.Title(), Offset: s.Offset, Speed: s.Speed, Score: s.Score, FalseAlarm: s.FalseAlarm}
+		}
+		timeline.Segments = append(timeline.Segments, seg)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(timeline)
+}
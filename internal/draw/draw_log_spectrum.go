@@ -9,23 +9,58 @@ import (
 func DrawLogSpectrum(magnitudes []float64, sampleRate int, numBars int) {
 	fmt.Println("\n--- Logarithmic Frequency Spectrum ---")
 
+	for _, bar := range logSpectrumBars(magnitudes, sampleRate, numBars) {
+		minDB := -70.0
+		maxDB := 0.0
+
+		normalzied := (bar.db - minDB) / (maxDB - minDB)
+		normalzied = max(0, min(1, normalzied))
+
+		barLen := int(normalzied * 70)
+		barBuilder := strings.Builder{}
+		// for i := range barLen {
+		// 	if i == 0 {
+		// 		barBuilder.WriteString("|█|")
+		// 	}
+		// 	barBuilder.WriteString("█|")
+		// }
+
+		for range barLen {
+			barBuilder.WriteString("█")
+		}
+
+		freqLabel := fmt.Sprintf("%0.fHz", bar.highF)
+		fmt.Printf("\n%8s | %s (%.1f dB)", freqLabel, barBuilder.String(), bar.db)
+	}
+}
+
+type spectrumBar struct {
+	highF float64
+	db    float64
+}
+
+// logSpectrumBars groups the half spectrum magnitudes, from DC to Nyquist,
+// into numBars bands log spaced from 20Hz to 20kHz and returns the peak level
+// of each. Bands above Nyquist, which low sample rates do not reach, are
+// empty.
+func logSpectrumBars(magnitudes []float64, sampleRate int, numBars int) []spectrumBar {
 	minFreq := 20.0
 	maxFreq := 20_000.0
 
 	logScale := math.Log(maxFreq / minFreq)
+	fftSize := 2 * (len(magnitudes) - 1)
+	nyquist := len(magnitudes) - 1
 
+	bars := make([]spectrumBar, numBars)
 	for i := range numBars {
 		lowF := minFreq * math.Exp(logScale*float64(i)/float64(numBars))
 		highF := minFreq * math.Exp(logScale*float64(i+1)/float64(numBars))
 
-		idxStart := int(lowF * float64(len(magnitudes)) / float64(sampleRate))
-		idxEnd := int(highF * float64(len(magnitudes)) / float64(sampleRate))
+		idxStart := int(lowF * float64(fftSize) / float64(sampleRate))
+		idxEnd := int(highF * float64(fftSize) / float64(sampleRate))
 
 		idxStart = max(idxStart, 0)
-		idxEnd = min(idxEnd, len(magnitudes)-1)
-		if idxStart >= idxEnd {
-			idxEnd = idxStart + 1
-		}
+		idxEnd = min(max(idxEnd, idxStart+1), nyquist+1)
 
 		maxMagInBin := 0.0
 		for j := idxStart; j < idxEnd; j++ {
@@ -36,28 +71,7 @@ func DrawLogSpectrum(magnitudes []float64, sampleRate int, numBars int) {
 
 		epsilon := 1e-9
 		maxMagInBin = max(maxMagInBin, epsilon)
-		dbVal := 20 * math.Log10(maxMagInBin)
-
-		minDB := -70.0
-		maxDB := 0.0
-
-		normalzied := (dbVal - minDB) / (maxDB - minDB)
-		normalzied = max(0, min(1, normalzied))
-
-		barLen := int(normalzied * 70)
-		barBuilder := strings.Builder{}
-		// for i := range barLen {
-		// 	if i == 0 {
-		// 		barBuilder.WriteString("|█|")
-		// 	}
-		// 	barBuilder.WriteString("█|")
-		// }
-
-		for range barLen {
-			barBuilder.WriteString("█")
-		}
-
-		freqLabel := fmt.Sprintf("%0.fHz", highF)
-		fmt.Printf("\n%8s | %s (%.1f dB)", freqLabel, barBuilder.String(), dbVal)
+		bars[i] = spectrumBar{highF: highF, db: 20 * math.Log10(maxMagInBin)}
 	}
+	return bars
 }
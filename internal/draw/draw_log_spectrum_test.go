@@ -0,0 +1,27 @@
+package draw
+
+import "testing"
+
+func TestLogSpectrumBarsAboveNyquist(t *testing.T) {
+	magnitudes := make([]float64, 4096/2+1)
+	for i := range magnitudes {
+		magnitudes[i] = 1
+	}
+
+	for _, rate := range []int{16000, 22050, 44100} {
+		bars := logSpectrumBars(magnitudes, rate, 40)
+		if len(bars) != 40 {
+			t.Fatalf("%d Hz: got %d bars, want 40", rate, len(bars))
+		}
+		for _, bar := range bars {
+			// The bar ending just past Nyquist still holds its last bins.
+			lowF := bar.highF / bars[1].highF * bars[0].highF
+			switch {
+			case lowF < float64(rate)/2 && bar.db != 0:
+				t.Errorf("%d Hz: bar up to %.0fHz at %.1f dB, want 0 dB", rate, bar.highF, bar.db)
+			case lowF > float64(rate)/2 && bar.db > -100:
+				t.Errorf("%d Hz: bar up to %.0fHz above Nyquist at %.1f dB, want it empty", rate, bar.highF, bar.db)
+			}
+		}
+	}
+}
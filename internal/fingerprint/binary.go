@@ -0,0 +1,159 @@
+package fingerprint
+
+import (
+	"audateci/internal/signal"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+)
+
+// The binary format is
+//
+//	magic    "AFPB"
+//	version  uvarint, the schema Version
+//	header   uvarint length, then the File as JSON without points or hashes
+//	points   uvarint count, then per point the zigzag varint deltas of its
+//	         frame and bin from the previous point, and its dB as an int8
+//	channels optional, per point the uvarint of its channel. Only written
+//	         when some point is not in channel 0
+//	crc      CRC-32 (IEEE) of everything before it, little endian
+//
+// Times are stored in frames and frequencies in bins of the recorded
+// parameters. Hashes are not stored, they are derived from the points again
+// when decoding.
+const binaryMagic = "AFPB"
+
+const (
+	JSONExt   = ".json"
+	BinaryExt = ".afp"
+)
+
+// EncodeBinary writes f in the binary format.
+func EncodeBinary(w io.Writer, f *File) error {
+	var buf []byte
+	buf = append(buf, binaryMagic...)
+	buf = binary.AppendUvarint(buf, uint64(f.Version))
+
+	header := *f
+	header.Points, header.Hashes = nil, nil
+	meta, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(meta)))
+	buf = append(buf, meta...)
+
+	timeStep, freqStep := f.steps()
+	buf = binary.AppendUvarint(buf, uint64(len(f.Points)))
+	prevFrame, prevBin := 0, 0
+	for _, p := range f.Points {
+		frame := int(math.Round(p.TimeSec / timeStep))
+		bin := int(math.Round(p.FreqHz / freqStep))
+		buf = binary.AppendVarint(buf, int64(frame-prevFrame))
+		buf = binary.AppendVarint(buf, int64(bin-prevBin))
+		buf = append(buf, byte(int8(max(math.MinInt8, min(math.MaxInt8, math.Round(p.MagDB))))))
+		prevFrame, prevBin = frame, bin
+	}
+	if slices.ContainsFunc(f.Points, func(p signal.KeyPoint) bool { return p.Channel != 0 }) {
+		for _, p := range f.Points {
+			buf = binary.AppendUvarint(buf, uint64(p.Channel))
+		}
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	_, err = w.Write(buf)
+	return err
+}
+
+// steps are the frame hop in seconds and the bin width in Hz.
+func (f *File) steps() (float64, float64) {
+	p := f.Params.Pairing()
+	return p.TimeStep, p.FreqStep
+}
+
+func isBinary(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(binaryMagic))
+}
+
+var errTruncated = errors.New("truncated binary fingerprint")
+
+// decodeBinary reads a fingerprint written by EncodeBinary.
+func decodeBinary(data []byte) (*File, error) {
+	if len(data) < len(binaryMagic)+4 || !isBinary(data) {
+		return nil, fmt.Errorf("not a binary fingerprint")
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("binary fingerprint checksum mismatch")
+	}
+
+	r := bufio.NewReader(bytes.NewReader(body[len(binaryMagic):]))
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errTruncated
+	}
+	if version != Version {
+		return nil, fmt.Errorf("binary fingerprint version %d, expected %d", version, Version)
+	}
+
+	metaLen, err := binary.ReadUvarint(r)
+	if err != nil || metaLen > uint64(len(body)) {
+		return nil, errTruncated
+	}
+	meta := make([]byte, metaLen)
+	if _, err := io.ReadFull(r, meta); err != nil {
+		return nil, errTruncated
+	}
+	f := &File{}
+	if err := json.Unmarshal(meta, f); err != nil {
+		return nil, fmt.Errorf("decoding binary fingerprint header: %w", err)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	count, err := binary.ReadUvarint(r)
+	// Every point takes at least three bytes.
+	if err != nil || count > uint64(len(body))/3 {
+		return nil, errTruncated
+	}
+	timeStep, freqStep := f.steps()
+	f.Points = make([]signal.KeyPoint, count)
+	frame, bin := int64(0), int64(0)
+	for i := range f.Points {
+		dFrame, err1 := binary.ReadVarint(r)
+		dBin, err2 := binary.ReadVarint(r)
+		mag, err3 := r.ReadByte()
+		if err := errors.Join(err1, err2, err3); err != nil {
+			return nil, errTruncated
+		}
+		frame, bin = frame+dFrame, bin+dBin
+		f.Points[i] = signal.KeyPoint{
+			TimeSec: math.Round(float64(frame)*timeStep*1000) / 1000,
+			FreqHz:  math.Round(float64(bin) * freqStep),
+			MagDB:   float64(int8(mag)),
+		}
+	}
+	if r.Buffered() > 0 {
+		for i := range f.Points {
+			channel, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, errTruncated
+			}
+			f.Points[i].Channel = int(channel)
+		}
+	}
+	if r.Buffered() > 0 {
+		return nil, fmt.Errorf("%d trailing bytes in binary fingerprint", r.Buffered())
+	}
+
+	f.Hashes = signal.GetLandmarks(f.Points, f.Params.Pairing())
+	return f, nil
+}
@@ -0,0 +1,371 @@
+// Package fingerprint defines the file format fingerprints are stored in,
+// shared by every command that writes or reads them.
+package fingerprint
+
+import (
+	"audateci/internal/signal"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version 3 records the analysis parameters and the source checksum, and
+// optionally the song ID and metadata.
+// Version 2 added landmark hashes, version 1 files only hold key points.
+// Older files are migrated when they are decoded.
+const Version = 3
+
+// Params are the analysis parameters a fingerprint was made with.
+type Params struct {
+	// SampleRate is the rate the audio was analyzed at. When analyzing, 0
+	// keeps the rate of the file.
+	SampleRate int    `json:"sample_rate"`
+	WindowSize int    `json:"window_size"`
+	HopSize    int    `json:"hop_size"`
+	Window     string `json:"window"`
+	Channels   string `json:"channels"`
+
+	Peaks   signal.PeakStrategy `json:"peaks"`
+	Density float64             `json:"density,omitempty"`
+	Bands   signal.BandLayout   `json:"bands"`
+	// Hash is the landmark hashing scheme, see signal.HashScheme.
+	Hash string `json:"hash"`
+}
+
+// DefaultParams are the parameters the commands use when no flag says
+// otherwise.
+func DefaultParams() Params {
+	return Params{
+		SampleRate: signal.AnalysisSampleRate,
+		WindowSize: 2048,
+		HopSize:    1024,
+		Window:     signal.Hann.Name,
+		Channels:   signal.DownmixChannels.String(),
+		Peaks:      signal.Peaks2D,
+		Density:    signal.DefaultPeakPicker.Density,
+		Bands:      signal.DefaultBandLayout,
+		Hash:       signal.HashScheme,
+	}
+}
+
+// STFT builds the transform described by p.
+func (p Params) STFT() (*signal.STFT, error) {
+	window, err := signal.ParseWindow(p.Window)
+	if err != nil {
+		return nil, err
+	}
+	stft := signal.NewSTFT(p.WindowSize, p.HopSize)
+	stft.Window = window
+	return stft, nil
+}
+
+// Pairing is the landmark pairing for key points analyzed with p.
+func (p Params) Pairing() signal.Pairing {
+	return signal.NewPairing(signal.NewSTFT(p.WindowSize, p.HopSize), p.SampleRate)
+}
+
+// Compatible reports why hashes made with p cannot be looked up among hashes
+// made with other, or nil if they can. The window shape, the channels and
+// the peak picking only change which peaks are found, not what their hashes
+// mean, so they may differ.
+func (p Params) Compatible(other Params) error {
+	switch {
+	case p.Hash != other.Hash:
+		return fmt.Errorf("hash scheme '%s' differs from '%s'", p.Hash, other.Hash)
+	case p.SampleRate != other.SampleRate:
+		return fmt.Errorf("analyzed at %d Hz instead of %d Hz", p.SampleRate, other.SampleRate)
+	case p.WindowSize != other.WindowSize || p.HopSize != other.HopSize:
+		return fmt.Errorf("window %d/hop %d differs from window %d/hop %d", p.WindowSize, p.HopSize, other.WindowSize, other.HopSize)
+	case !p.Bands.Equal(other.Bands):
+		return fmt.Errorf("band layout '%s' differs from '%s'", p.Bands, other.Bands)
+	}
+	return nil
+}
+
+func (p Params) validate() error {
+	switch {
+	case p.SampleRate <= 0:
+		return fmt.Errorf("invalid sample rate %d", p.SampleRate)
+	case p.WindowSize <= 0 || p.HopSize <= 0:
+		return fmt.Errorf("invalid window %d/hop %d", p.WindowSize, p.HopSize)
+	case len(p.Bands.Bands) == 0:
+		return fmt.Errorf("no frequency bands")
+	case p.Hash != signal.HashScheme:
+		return fmt.Errorf("unknown hash scheme '%s'", p.Hash)
+	}
+	if _, err := signal.ParsePeakStrategy(string(p.Peaks)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// File is a fingerprint as it is stored on disk.
+type File struct {
+	Version int `json:"version"`
+	// Tool is the build of audateci that wrote the file.
+	Tool     string `json:"tool,omitempty"`
+	Filename string `json:"filename"`
+	// ID identifies the song in its database, 0 until it is added to one.
+	ID   uint32   `json:"id,omitempty"`
+	Meta Metadata `json:"meta,omitzero"`
+	// Checksum identifies the source audio, as "sha256:" and the hex digest
+	// of the whole file.
+	Checksum string            `json:"checksum,omitempty"`
+	Duration float64           `json:"duration,omitempty"`
+	Params   Params            `json:"params"`
+	Points   []signal.KeyPoint `json:"points"`
+	Hashes   []signal.Landmark `json:"hashes"`
+}
+
+// Metadata describes the recording a fingerprint was made from, filled from
+// the tags of the audio file when it has them.
+type Metadata struct {
+	Title  string `json:"title,omitempty"`
+	Artist string `json:"artist,omitempty"`
+	Album  string `json:"album,omitempty"`
+	// Source is the path or URL the audio was read from.
+	Source   string    `json:"source,omitempty"`
+	Imported time.Time `json:"imported,omitzero"`
+}
+
+// Validate checks that f is a current fingerprint with usable parameters.
+func (f *File) Validate() error {
+	if f.Version != Version {
+		return fmt.Errorf("fingerprint version %d, expected %d", f.Version, Version)
+	}
+	if err := f.Params.validate(); err != nil {
+		return fmt.Errorf("fingerprint of '%s': %w", f.Filename, err)
+	}
+	return nil
+}
+
+// legacyFile holds the fields of every version before 3.
+type legacyFile struct {
+	Filename   string             `json:"filename"`
+	Duration   float64            `json:"duration"`
+	SampleRate int                `json:"sample_rate"`
+	Points     []signal.KeyPoint  `json:"points"`
+	Hashes     []signal.Landmark  `json:"hashes"`
+	Bands      *signal.BandLayout `json:"bands"`
+}
+
+// Decode reads a fingerprint in either format, migrating older JSON
+// versions to the current one. Those did not record how they were made,
+// assumed gives the parameters to take for what they do not say.
+func Decode(r io.Reader, assumed Params) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if isBinary(data) {
+		return decodeBinary(data)
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("decoding fingerprint: %w", err)
+	}
+
+	var f *File
+	switch {
+	case header.Version > Version:
+		return nil, fmt.Errorf("fingerprint version %d is newer than this build supports (%d)", header.Version, Version)
+	case header.Version == Version:
+		f = &File{}
+		err = json.Unmarshal(data, f)
+	default:
+		var legacy legacyFile
+		err = json.Unmarshal(data, &legacy)
+		f = migrate(header.Version, legacy, assumed)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding fingerprint: %w", err)
+	}
+
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func migrate(version int, legacy legacyFile, assumed Params) *File {
+	params := assumed
+	params.Hash = signal.HashScheme
+	params.Bands = signal.DefaultBandLayout
+	if legacy.Bands != nil {
+		params.Bands = *legacy.Bands
+	}
+	if legacy.SampleRate > 0 {
+		params.SampleRate = legacy.SampleRate
+	}
+
+	hashes := legacy.Hashes
+	if version < 2 {
+		// Version 1 only had the band maxima and no hashes.
+		params.Peaks = signal.PeaksBandMax
+		hashes = signal.GetLandmarks(legacy.Points, params.Pairing())
+	}
+
+	return &File{
+		Version:  Version,
+		Filename: legacy.Filename,
+		Duration: legacy.Duration,
+		Params:   params,
+		Points:   legacy.Points,
+		Hashes:   hashes,
+	}
+}
+
+// Load reads the fingerprint at path, see Decode.
+func Load(path string, assumed Params) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fp, err := Decode(f, assumed)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fp, nil
+}
+
+// Save writes f to path, in the binary format if path ends in BinaryExt and
+// as JSON otherwise. JSON is indented for reading when indent is set.
+func Save(path string, f *File, indent bool) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if filepath.Ext(path) == BinaryExt {
+		err = EncodeBinary(out, f)
+	} else {
+		encoder := json.NewEncoder(out)
+		if indent {
+			encoder.SetIndent("", "  ")
+		}
+		err = encoder.Encode(f)
+	}
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// ErrBothFormats is returned by Convert when a directory would hold a song
+// as both a JSON and a binary fingerprint, which Glob would list, and a scan
+// index, twice.
+var ErrBothFormats = errors.New("fingerprint would be stored in both formats")
+
+// Convert saves fp, loaded from path, into dir with the extension ext and
+// returns the path written. The source is removed afterwards unless keep is
+// set or the output replaced it. Convert refuses, before writing, when dir
+// would be left holding the song in the other format too.
+func Convert(fp *File, path, dir, ext string, indent, keep bool) (string, error) {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	output := filepath.Join(dir, stem+ext)
+	for _, other := range []string{JSONExt, BinaryExt} {
+		twin := filepath.Join(dir, stem+other)
+		if other == ext || !keep && sameFile(twin, path) {
+			continue
+		}
+		if _, err := os.Stat(twin); err == nil {
+			return "", fmt.Errorf("%s: '%s' already exists: %w", output, twin, ErrBothFormats)
+		}
+	}
+
+	replaced := sameFile(output, path)
+	if err := Save(output, fp, indent); err != nil {
+		return "", err
+	}
+	if !keep && !replaced {
+		if err := os.Remove(path); err != nil {
+			return output, err
+		}
+	}
+	return output, nil
+}
+
+func sameFile(a, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	return err == nil && os.SameFile(infoA, infoB)
+}
+
+// Glob lists the fingerprints of both formats in dir.
+func Glob(dir string) ([]string, error) {
+	var files []string
+	for _, ext := range []string{JSONExt, BinaryExt} {
+		found, err := filepath.Glob(filepath.Join(dir, "*"+ext))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, found...)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// FormatExt returns the file extension of a format given on the command
+// line: json or binary.
+func FormatExt(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "json":
+		return JSONExt, nil
+	case "binary", "bin", "afp":
+		return BinaryExt, nil
+	}
+	return "", fmt.Errorf("unknown fingerprint format '%s', expected 'json' or 'binary'", format)
+}
+
+// Checksum hashes the file at path for File.Checksum.
+func Checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ToolVersion describes the running build: its module version, or the vcs
+// revision it was built from.
+func ToolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "audateci"
+	}
+
+	version := info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && (version == "" || version == "(devel)") {
+			version = setting.Value[:min(12, len(setting.Value))]
+		}
+	}
+	if version == "" {
+		return "audateci"
+	}
+	return "audateci " + version
+}
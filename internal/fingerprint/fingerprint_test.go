@@ -0,0 +1,190 @@
+package fingerprint
+
+import (
+	"audateci/internal/signal"
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeMigratesLegacyFiles(t *testing.T) {
+	assumed := DefaultParams()
+	assumed.SampleRate = 22050
+
+	v1 := `{"filename": "song", "points": [{"t": 0, "f": 440, "m": -10}, {"t": 0.093, "f": 880, "m": -12}]}`
+	fp, err := Decode(strings.NewReader(v1), assumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.Version != Version || fp.Params.Peaks != signal.PeaksBandMax || fp.Params.SampleRate != 22050 {
+		t.Errorf("version 1 migrated to version %d, %s peaks at %d Hz", fp.Version, fp.Params.Peaks, fp.Params.SampleRate)
+	}
+	if want := signal.GetLandmarks(fp.Points, fp.Params.Pairing()); len(fp.Hashes) != 1 || fp.Hashes[0] != want[0] {
+		t.Errorf("version 1 hashes %v, want %v", fp.Hashes, want)
+	}
+
+	v2 := `{"version": 2, "filename": "song", "sample_rate": 48000, "points": [], "hashes": [{"h": 7, "t": 1.5}],
+		"bands": {"name": "log:2", "ranges": [{"min": 40, "max": 632}, {"min": 632, "max": 10000}]}}`
+	fp, err = Decode(strings.NewReader(v2), assumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.Params.SampleRate != 48000 || fp.Params.Bands.Name != "log:2" || len(fp.Hashes) != 1 {
+		t.Errorf("version 2 migrated to %+v", fp)
+	}
+}
+
+func TestDecodeValidates(t *testing.T) {
+	fp := &File{Version: Version, Filename: "song", Params: DefaultParams()}
+	encode := func(f *File) string {
+		data, err := json.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if _, err := Decode(strings.NewReader(encode(fp)), DefaultParams()); err != nil {
+		t.Fatalf("current file rejected: %v", err)
+	}
+
+	newer := *fp
+	newer.Version = Version + 1
+	bad := *fp
+	bad.Params.WindowSize = 0
+	unknown := *fp
+	unknown.Params.Hash = "pair-f8-f8-dt16"
+	for _, f := range []*File{&newer, &bad, &unknown} {
+		if _, err := Decode(bytes.NewReader([]byte(encode(f))), DefaultParams()); err == nil {
+			t.Errorf("%+v: expected an error", f.Params)
+		}
+	}
+}
+
+func TestParamsCompatible(t *testing.T) {
+	base := DefaultParams()
+
+	other := base
+	other.Window = signal.Hamming.Name
+	other.Peaks = signal.PeaksBandMax
+	other.Channels = "all"
+	if err := base.Compatible(other); err != nil {
+		t.Errorf("peak picking differences reported as incompatible: %v", err)
+	}
+
+	for _, change := range []func(*Params){
+		func(p *Params) { p.SampleRate = 48000 },
+		func(p *Params) { p.WindowSize, p.HopSize = 4096, 2048 },
+		func(p *Params) { p.Bands, _ = signal.ParseBandLayout("bark") },
+	} {
+		other := base
+		change(&other)
+		if err := base.Compatible(other); err == nil {
+			t.Errorf("%+v reported as compatible", other)
+		}
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	params := DefaultParams()
+	step := params.Pairing()
+
+	var points []signal.KeyPoint
+	for frame := range 200 {
+		for _, bin := range []int{12, 12 + frame%7, 300 - frame} {
+			points = append(points, signal.KeyPoint{
+				TimeSec: math.Round(float64(frame)*step.TimeStep*1000) / 1000,
+				FreqHz:  math.Round(float64(bin) * step.FreqStep),
+				MagDB:   -20.37 - float64(frame%90),
+			})
+		}
+	}
+	fp := &File{Version: Version, Filename: "song", ID: 7, Checksum: "sha256:00", Duration: 5, Params: params, Points: points}
+	fp.Meta = Metadata{Title: "Song", Artist: "Band", Source: "song.wav", Imported: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	fp.Hashes = signal.GetLandmarks(points, step)
+
+	var buf bytes.Buffer
+	if err := EncodeBinary(&buf, fp); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+
+	got, err := Decode(bytes.NewReader(encoded), Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := got.Meta
+	if got.Filename != fp.Filename || got.ID != fp.ID || got.Checksum != fp.Checksum || got.Params.Compatible(params) != nil ||
+		meta.Title != fp.Meta.Title || meta.Artist != fp.Meta.Artist || meta.Source != fp.Meta.Source || !meta.Imported.Equal(fp.Meta.Imported) {
+		t.Errorf("header decoded as %+v", got)
+	}
+	if len(got.Points) != len(points) {
+		t.Fatalf("decoded %d points, want %d", len(got.Points), len(points))
+	}
+	for i, p := range got.Points {
+		want := points[i]
+		if p.TimeSec != want.TimeSec || p.FreqHz != want.FreqHz || p.MagDB != math.Round(want.MagDB) {
+			t.Fatalf("point %d decoded as %+v, want %+v", i, p, want)
+		}
+	}
+	if len(got.Hashes) != len(fp.Hashes) {
+		t.Fatalf("derived %d hashes, want %d", len(got.Hashes), len(fp.Hashes))
+	}
+	for i, h := range got.Hashes {
+		if h != fp.Hashes[i] {
+			t.Fatalf("hash %d decoded as %+v, want %+v", i, h, fp.Hashes[i])
+		}
+	}
+
+	data, _ := json.Marshal(fp)
+	if len(encoded)*8 > len(data) {
+		t.Errorf("binary takes %d bytes, json %d", len(encoded), len(data))
+	}
+
+	corrupt := bytes.Clone(encoded)
+	corrupt[len(corrupt)/2] ^= 1
+	for _, bad := range [][]byte{corrupt, encoded[:len(encoded)-10]} {
+		if _, err := Decode(bytes.NewReader(bad), Params{}); err == nil {
+			t.Error("damaged binary fingerprint decoded")
+		}
+	}
+}
+
+func TestBinaryKeepsChannels(t *testing.T) {
+	params := DefaultParams()
+	params.Channels = signal.ChannelMode{Kind: signal.ChannelAll}.String()
+	step := params.Pairing()
+
+	var points []signal.KeyPoint
+	for frame := range 50 {
+		for channel := range 2 {
+			points = append(points, signal.KeyPoint{
+				TimeSec: math.Round(float64(frame)*step.TimeStep*1000) / 1000,
+				FreqHz:  math.Round(float64(40+frame%9) * step.FreqStep),
+				MagDB:   -30,
+				Channel: channel,
+			})
+		}
+	}
+	fp := &File{Version: Version, Filename: "stereo", Params: params, Points: points, Hashes: signal.GetLandmarks(points, step)}
+
+	var buf bytes.Buffer
+	if err := EncodeBinary(&buf, fp); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(&buf, Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range got.Points {
+		if p.Channel != points[i].Channel {
+			t.Fatalf("point %d decoded in channel %d, want %d", i, p.Channel, points[i].Channel)
+		}
+	}
+	if len(got.Hashes) != len(fp.Hashes) {
+		t.Fatalf("derived %d hashes, want %d", len(got.Hashes), len(fp.Hashes))
+	}
+}
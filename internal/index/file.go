@@ -0,0 +1,326 @@
+package index
+
+import (
+	"audateci/internal/fingerprint"
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// FileName is the name of the prebuilt index inside a database directory.
+const FileName = "index.afi"
+
+// The index file is laid out so that it can be memory mapped and searched
+// in place. All integers are little endian uint32.
+//
+//	magic     "AFPI"
+//	version   formatVersion
+//	meta      length, then the parameters and songs as JSON
+//	counts    number of distinct hashes H, number of postings P
+//	hashes    H hashes in ascending order
+//	offsets   H+1 offsets, the postings of hash i are offsets[i]:offsets[i+1]
+//	postings  P pairs of song ID and frame
+//	crc       CRC-32 (IEEE) of everything before it
+const (
+	fileMagic     = "AFPI"
+	formatVersion = 3
+)
+
+type fileMeta struct {
+	Params  fingerprint.Params `json:"params"`
+	Songs   []Song             `json:"songs"`
+	LastID  uint32             `json:"last_id"`
+	Skipped []Song             `json:"skipped,omitempty"`
+}
+
+// Write stores m as an index file at path.
+func (m *Memory) Write(path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	crc := crc32.NewIEEE()
+	w := bufio.NewWriter(io.MultiWriter(out, crc))
+	put := func(v uint32) {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], v)
+		w.Write(b[:])
+	}
+
+	meta, err := json.Marshal(fileMeta{Params: m.params, Songs: m.songs, LastID: m.lastID, Skipped: m.skipped})
+	if err != nil {
+		return err
+	}
+	w.WriteString(fileMagic)
+	put(formatVersion)
+	put(uint32(len(meta)))
+	w.Write(meta)
+
+	hashes := make([]uint32, 0, len(m.postings))
+	total := 0
+	for h, list := range m.postings {
+		hashes = append(hashes, h)
+		total += len(list)
+	}
+	slices.Sort(hashes)
+
+	put(uint32(len(hashes)))
+	put(uint32(total))
+	for _, h := range hashes {
+		put(h)
+	}
+	offset := 0
+	for _, h := range hashes {
+		put(uint32(offset))
+		offset += len(m.postings[h])
+	}
+	put(uint32(offset))
+	for _, h := range hashes {
+		for _, p := range m.postings[h] {
+			put(p.song)
+			put(p.frame)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc.Sum32())
+	if _, err := out.Write(sum[:]); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// File is an index opened from an index file.
+type File struct {
+	data     mapping
+	meta     fileMeta
+	byID     map[uint32]int
+	base     timeBase
+	count    int
+	hashes   []byte
+	offsets  []byte
+	postings []byte
+}
+
+// Open maps the index file at path. Its contents are only checked for
+// consistency, Verify checks the whole file.
+func Open(path string) (*File, error) {
+	data, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := parseFile(data)
+	if err != nil {
+		data.unmap()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+func parseFile(data mapping) (*File, error) {
+	b := data.bytes()
+	errCorrupt := fmt.Errorf("corrupt index file")
+	if len(b) < 12 || string(b[:4]) != fileMagic {
+		return nil, fmt.Errorf("not an index file")
+	}
+	if v := binary.LittleEndian.Uint32(b[4:]); v != formatVersion {
+		return nil, fmt.Errorf("index format version %d, expected %d", v, formatVersion)
+	}
+
+	pos := 8
+	next := func(n int) ([]byte, bool) {
+		if n < 0 || n > len(b)-pos {
+			return nil, false
+		}
+		pos += n
+		return b[pos-n : pos], true
+	}
+	u32 := func() (int, bool) {
+		v, ok := next(4)
+		if !ok {
+			return 0, false
+		}
+		return int(binary.LittleEndian.Uint32(v)), true
+	}
+
+	f := &File{data: data}
+	metaLen, ok := u32()
+	if !ok {
+		return nil, errCorrupt
+	}
+	meta, ok := next(metaLen)
+	if !ok {
+		return nil, errCorrupt
+	}
+	if err := json.Unmarshal(meta, &f.meta); err != nil {
+		return nil, fmt.Errorf("decoding index metadata: %w", err)
+	}
+
+	hashCount, ok1 := u32()
+	postingCount, ok2 := u32()
+	f.hashes, ok = next(4 * hashCount)
+	if !ok || !ok1 || !ok2 {
+		return nil, errCorrupt
+	}
+	if f.offsets, ok = next(4 * (hashCount + 1)); !ok {
+		return nil, errCorrupt
+	}
+	if f.postings, ok = next(8 * postingCount); !ok || len(b)-pos != 4 {
+		return nil, errCorrupt
+	}
+	// The postings of hash i span offsets i to i+1, so the offsets must
+	// not decrease and end at the last posting.
+	prev := uint32(0)
+	for i := range hashCount + 1 {
+		offset := binary.LittleEndian.Uint32(f.offsets[4*i:])
+		if offset < prev || int(offset) > postingCount {
+			return nil, errCorrupt
+		}
+		prev = offset
+	}
+	if int(prev) != postingCount {
+		return nil, errCorrupt
+	}
+
+	f.byID = make(map[uint32]int, len(f.meta.Songs))
+	for i, song := range f.meta.Songs {
+		f.byID[song.ID] = i
+	}
+	f.count = hashCount
+	f.base = timeBase(f.meta.Params.Pairing().TimeStep)
+	return f, nil
+}
+
+func (f *File) hashAt(i int) uint32 {
+	return binary.LittleEndian.Uint32(f.hashes[4*i:])
+}
+
+func (f *File) Lookup(hash uint32, fn func(id uint32, timeSec float64)) {
+	i := sort.Search(f.count, func(i int) bool { return f.hashAt(i) >= hash })
+	if i == f.count || f.hashAt(i) != hash {
+		return
+	}
+
+	start := binary.LittleEndian.Uint32(f.offsets[4*i:])
+	end := binary.LittleEndian.Uint32(f.offsets[4*i+4:])
+	for p := start; p < end && int(p) < len(f.postings)/8; p++ {
+		entry := f.postings[8*p:]
+		fn(binary.LittleEndian.Uint32(entry), f.base.seconds(binary.LittleEndian.Uint32(entry[4:])))
+	}
+}
+
+// Memory loads the whole index into memory, to be changed and written
+// again.
+func (f *File) Memory() *Memory {
+	m := NewMemory(f.meta.Params)
+	m.songs = slices.Clone(f.meta.Songs)
+	m.byID = maps.Clone(f.byID)
+	m.lastID = f.meta.LastID
+	m.skipped = slices.Clone(f.meta.Skipped)
+
+	for i := range f.count {
+		start := binary.LittleEndian.Uint32(f.offsets[4*i:])
+		end := binary.LittleEndian.Uint32(f.offsets[4*i+4:])
+		list := make([]posting, 0, end-start)
+		for p := start; p < end; p++ {
+			entry := f.postings[8*p:]
+			list = append(list, posting{song: binary.LittleEndian.Uint32(entry), frame: binary.LittleEndian.Uint32(entry[4:])})
+		}
+		m.postings[f.hashAt(i)] = list
+	}
+	return m
+}
+
+func (f *File) Song(id uint32) (Song, bool) {
+	i, ok := f.byID[id]
+	if !ok {
+		return Song{}, false
+	}
+	return f.meta.Songs[i], true
+}
+
+func (f *File) Songs() []Song {
+	return f.meta.Songs
+}
+
+func (f *File) Params() fingerprint.Params {
+	return f.meta.Params
+}
+
+func (f *File) Close() error {
+	return f.data.unmap()
+}
+
+func (f *File) known(id uint32) bool {
+	_, ok := f.byID[id]
+	return ok
+}
+
+// Verify checks the checksum of the whole file and that postings only refer
+// to known songs.
+func (f *File) Verify() error {
+	b := f.data.bytes()
+	if crc32.ChecksumIEEE(b[:len(b)-4]) != binary.LittleEndian.Uint32(b[len(b)-4:]) {
+		return fmt.Errorf("index checksum mismatch")
+	}
+	if len(f.byID) != len(f.meta.Songs) {
+		return fmt.Errorf("song IDs are not unique")
+	}
+	for i := 0; i < len(f.postings); i += 8 {
+		if id := binary.LittleEndian.Uint32(f.postings[i:]); !f.known(id) {
+			return fmt.Errorf("posting %d refers to unknown song %d", i/8, id)
+		}
+	}
+	for i := 1; i < f.count; i++ {
+		if f.hashAt(i) <= f.hashAt(i-1) {
+			return fmt.Errorf("hashes out of order at %d", i)
+		}
+	}
+	return nil
+}
+
+// Stale reports why the index no longer describes the fingerprints in dir,
+// or nil if it still does.
+func (f *File) Stale(dir string) error {
+	files, err := fingerprint.Glob(dir)
+	if err != nil {
+		return err
+	}
+
+	indexed := make(map[string]Song, len(f.meta.Songs))
+	for _, song := range slices.Concat(f.meta.Songs, f.meta.Skipped) {
+		indexed[song.File] = song
+	}
+	for _, file := range files {
+		song, ok := indexed[filepath.Base(file)]
+		if !ok {
+			return fmt.Errorf("'%s' is not indexed", file)
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if info.Size() != song.Size || info.ModTime().UnixNano() != song.ModTime {
+			return fmt.Errorf("'%s' changed since the index was built", file)
+		}
+		delete(indexed, song.File)
+	}
+	for name := range indexed {
+		return fmt.Errorf("'%s' was removed since the index was built", name)
+	}
+	return nil
+}
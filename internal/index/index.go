@@ -0,0 +1,248 @@
+// Package index maps landmark hashes to the songs of a fingerprint database
+// and the times they occur at, either built in memory from the fingerprints
+// or opened from a prebuilt index file.
+package index
+
+import (
+	"audateci/internal/fingerprint"
+	"cmp"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Index is an inverted index over the landmark hashes of a database whose
+// fingerprints all share Params.
+type Index interface {
+	// Lookup calls fn for every occurrence of hash, with the ID of its song
+	// and the time of the landmark in seconds.
+	Lookup(hash uint32, fn func(id uint32, timeSec float64))
+	Song(id uint32) (Song, bool)
+	Songs() []Song
+	Params() fingerprint.Params
+	Close() error
+}
+
+// Song is the catalogue record of an indexed fingerprint. File, Size and
+// ModTime describe the fingerprint file so that a prebuilt index can tell
+// when it is out of date.
+type Song struct {
+	ID       uint32               `json:"id"`
+	Name     string               `json:"name"`
+	Meta     fingerprint.Metadata `json:"meta,omitzero"`
+	Checksum string               `json:"checksum,omitempty"`
+	File     string               `json:"file"`
+	Size     int64                `json:"size"`
+	ModTime  int64                `json:"mtime"`
+	Duration float64              `json:"duration,omitempty"`
+	Points   int                  `json:"points"`
+	Hashes   int                  `json:"hashes"`
+}
+
+// Title is the song's title, after its artist when known. Songs fingerprinted
+// from files without tags fall back to the name they were fingerprinted as.
+func (s Song) Title() string {
+	title := cmp.Or(s.Meta.Title, s.Name)
+	if s.Meta.Artist != "" {
+		return s.Meta.Artist + " - " + title
+	}
+	return title
+}
+
+// posting is one occurrence of a hash in the song with ID song, its time in
+// frames of the database's hop.
+type posting struct {
+	song  uint32
+	frame uint32
+}
+
+// timeBase converts between seconds and frames the same way for both
+// implementations, times come back rounded to the millisecond like the
+// fingerprints store them.
+type timeBase float64
+
+func (b timeBase) frame(timeSec float64) uint32 {
+	return uint32(max(0, math.Round(timeSec/float64(b))))
+}
+
+func (b timeBase) seconds(frame uint32) float64 {
+	return math.Round(float64(frame)*float64(b)*1000) / 1000
+}
+
+// Memory is an index held in memory.
+type Memory struct {
+	params   fingerprint.Params
+	base     timeBase
+	songs    []Song
+	byID     map[uint32]int
+	postings map[uint32][]posting
+	// lastID is the highest ID ever handed out, IDs of removed songs are not
+	// reused.
+	lastID uint32
+	// skipped are the fingerprints Scan left out.
+	skipped []Song
+}
+
+func NewMemory(params fingerprint.Params) *Memory {
+	return &Memory{
+		params:   params,
+		base:     timeBase(params.Pairing().TimeStep),
+		byID:     make(map[uint32]int),
+		postings: make(map[uint32][]posting),
+	}
+}
+
+// NextID returns the ID the next song added without one will get.
+func (m *Memory) NextID() uint32 {
+	return m.lastID + 1
+}
+
+// Add indexes the hashes of fp, stored in file, which must be compatible
+// with the parameters of the index. The song keeps the ID recorded in fp,
+// unless it has none or it is taken, and then gets the next one.
+func (m *Memory) Add(fp *fingerprint.File, file string) error {
+	if err := fp.Params.Compatible(m.params); err != nil {
+		return err
+	}
+
+	id := fp.ID
+	if _, taken := m.byID[id]; taken || id == 0 {
+		id = m.NextID()
+	}
+	m.lastID = max(m.lastID, id)
+
+	song := describe(file)
+	song.ID = id
+	song.Name = fp.Filename
+	song.Meta = fp.Meta
+	song.Checksum = fp.Checksum
+	song.Duration = fp.Duration
+	song.Points, song.Hashes = len(fp.Points), len(fp.Hashes)
+	m.byID[id] = len(m.songs)
+	m.songs = append(m.songs, song)
+
+	for _, l := range fp.Hashes {
+		m.postings[l.Hash] = append(m.postings[l.Hash], posting{song: id, frame: m.base.frame(l.TimeSec)})
+	}
+	return nil
+}
+
+// RemoveFile drops the song stored in the fingerprint file named file, and
+// its postings. It reports whether the file was indexed, or skipped when
+// the index was built.
+func (m *Memory) RemoveFile(file string) bool {
+	if i := slices.IndexFunc(m.skipped, func(s Song) bool { return s.File == file }); i >= 0 {
+		m.skipped = slices.Delete(m.skipped, i, i+1)
+		return true
+	}
+
+	i := slices.IndexFunc(m.songs, func(s Song) bool { return s.File == file })
+	if i < 0 {
+		return false
+	}
+	id := m.songs[i].ID
+	m.songs = slices.Delete(m.songs, i, i+1)
+	delete(m.byID, id)
+	for j, s := range m.songs[i:] {
+		m.byID[s.ID] = i + j
+	}
+
+	for hash, list := range m.postings {
+		kept := slices.DeleteFunc(list, func(p posting) bool { return p.song == id })
+		if len(kept) == 0 {
+			delete(m.postings, hash)
+		} else {
+			m.postings[hash] = kept
+		}
+	}
+	return true
+}
+
+func describe(file string) Song {
+	song := Song{File: filepath.Base(file)}
+	if info, err := os.Stat(file); err == nil {
+		song.Size, song.ModTime = info.Size(), info.ModTime().UnixNano()
+	}
+	return song
+}
+
+func (m *Memory) Lookup(hash uint32, fn func(id uint32, timeSec float64)) {
+	for _, p := range m.postings[hash] {
+		fn(p.song, m.base.seconds(p.frame))
+	}
+}
+
+func (m *Memory) Song(id uint32) (Song, bool) {
+	i, ok := m.byID[id]
+	if !ok {
+		return Song{}, false
+	}
+	return m.songs[i], true
+}
+
+func (m *Memory) Songs() []Song {
+	return m.songs
+}
+
+func (m *Memory) Params() fingerprint.Params {
+	return m.params
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// Scan indexes every fingerprint in dir. The first one decides the
+// parameters of the index, or assumed when there is none; fingerprints that
+// cannot be read or were made with incompatible parameters are left out and
+// reported in skipped. Fingerprints without an ID are numbered after the
+// others, in the order of their files.
+func Scan(dir string, assumed fingerprint.Params) (idx *Memory, skipped []error, err error) {
+	files, err := fingerprint.Glob(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var left []string
+	add := func(fp *fingerprint.File, file string) {
+		if err := idx.Add(fp, file); err != nil {
+			skipped = append(skipped, fmt.Errorf("%s: %w", file, err))
+			left = append(left, file)
+		}
+	}
+	type unnumbered struct {
+		fp   *fingerprint.File
+		file string
+	}
+	var later []unnumbered
+	for _, file := range files {
+		fp, err := fingerprint.Load(file, assumed)
+		if err != nil {
+			skipped = append(skipped, err)
+			left = append(left, file)
+			continue
+		}
+
+		if idx == nil {
+			idx = NewMemory(fp.Params)
+		}
+		if fp.ID == 0 {
+			later = append(later, unnumbered{fp, file})
+			continue
+		}
+		add(fp, file)
+	}
+	for _, u := range later {
+		add(u.fp, u.file)
+	}
+
+	if idx == nil {
+		idx = NewMemory(assumed)
+	}
+	for _, file := range left {
+		idx.skipped = append(idx.skipped, describe(file))
+	}
+	return idx, skipped, nil
+}
@@ -0,0 +1,279 @@
+package index
+
+import (
+	"audateci/internal/fingerprint"
+	"audateci/internal/signal"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func writeFingerprints(t *testing.T, dir string, n int) {
+	t.Helper()
+	params := fingerprint.DefaultParams()
+	step := params.Pairing()
+
+	rng := rand.New(rand.NewSource(1))
+	for i := range n {
+		var points []signal.KeyPoint
+		for frame := range 300 {
+			points = append(points, signal.KeyPoint{
+				TimeSec: float64(frame) * step.TimeStep,
+				FreqHz:  float64(rng.Intn(400)) * step.FreqStep,
+				MagDB:   -20,
+			})
+		}
+		fp := &fingerprint.File{
+			Version:  fingerprint.Version,
+			Filename: string(rune('a' + i)),
+			Params:   params,
+			Points:   points,
+			Hashes:   signal.GetLandmarks(points, step),
+		}
+		if fp.Filename == "b" {
+			fp.ID = 10
+		}
+		ext := fingerprint.JSONExt
+		if i%2 == 1 {
+			ext = fingerprint.BinaryExt
+		}
+		if err := fingerprint.Save(filepath.Join(dir, fp.Filename+ext), fp, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type occurrence struct {
+	song uint32
+	time float64
+}
+
+func lookupAll(idx Index, hash uint32) []occurrence {
+	var found []occurrence
+	idx.Lookup(hash, func(song uint32, timeSec float64) {
+		found = append(found, occurrence{song, timeSec})
+	})
+	return found
+}
+
+func TestIndexFileMatchesMemory(t *testing.T) {
+	dir := t.TempDir()
+	writeFingerprints(t, dir, 4)
+
+	mem, skipped, err := Scan(dir, fingerprint.DefaultParams())
+	if err != nil || len(skipped) > 0 {
+		t.Fatal(err, skipped)
+	}
+	path := filepath.Join(dir, FileName)
+	if err := mem.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := file.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Stale(dir); err != nil {
+		t.Fatalf("fresh index reported stale: %v", err)
+	}
+	if len(file.Songs()) != 4 || file.Params().Compatible(mem.Params()) != nil {
+		t.Fatalf("index has %d songs, parameters %+v", len(file.Songs()), file.Params())
+	}
+	// b records its ID, the others are numbered after it.
+	for id, name := range map[uint32]string{10: "b.afp", 11: "a.json", 13: "d.afp"} {
+		if song, ok := file.Song(id); !ok || song.File != name {
+			t.Errorf("song %d is %+v, want '%s'", id, song, name)
+		}
+	}
+
+	for hash := range mem.postings {
+		want, got := lookupAll(mem, hash), lookupAll(file, hash)
+		if len(got) != len(want) {
+			t.Fatalf("hash %x: %d occurrences in the file, %d in memory", hash, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("hash %x: occurrence %d is %v in the file, %v in memory", hash, i, got[i], want[i])
+			}
+		}
+	}
+	if found := lookupAll(file, 0xffffffff); len(found) > 0 {
+		t.Errorf("unknown hash found %v", found)
+	}
+}
+
+func TestIndexFileStaleAndCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	writeFingerprints(t, dir, 2)
+	mem, _, _ := Scan(dir, fingerprint.DefaultParams())
+	path := filepath.Join(dir, FileName)
+	if err := mem.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.json"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	file, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Stale(dir) == nil {
+		t.Error("index not stale after a fingerprint changed")
+	}
+	file.Close()
+
+	data, _ := os.ReadFile(path)
+	// Offsets past the postings or going backwards are refused on opening,
+	// before Memory or Lookup could slice with them.
+	offsets := 12 + int(binary.LittleEndian.Uint32(data[8:]))
+	hashCount := int(binary.LittleEndian.Uint32(data[offsets:]))
+	offsets += 8 + 4*hashCount
+	for _, c := range []struct{ i, value int }{{1, 1 << 30}, {hashCount / 2, 0}} {
+		corrupt := slices.Clone(data)
+		binary.LittleEndian.PutUint32(corrupt[offsets+4*c.i:], uint32(c.value))
+		os.WriteFile(path, corrupt, 0o644)
+		if file, err := Open(path); err == nil {
+			file.Close()
+			t.Errorf("index with offset %d set to %d opened", c.i, c.value)
+		}
+	}
+
+	data[len(data)-20] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+	if file, err := Open(path); err == nil {
+		if file.Verify() == nil {
+			t.Error("corrupt index verified")
+		}
+		file.Close()
+	}
+
+	os.WriteFile(path, data[:len(data)/2], 0o644)
+	if _, err := Open(path); err == nil {
+		t.Error("truncated index opened")
+	}
+}
+
+func TestIndexIncrementalUpdate(t *testing.T) {
+	dir := t.TempDir()
+	writeFingerprints(t, dir, 3)
+	mem, _, _ := Scan(dir, fingerprint.DefaultParams())
+	path := filepath.Join(dir, FileName)
+	if err := mem.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := file.Memory()
+	file.Close()
+	if err := loaded.Diff(mem); err != nil {
+		t.Fatalf("index loaded from its file differs: %v", err)
+	}
+
+	c, _ := loaded.Song(12)
+	if !loaded.RemoveFile("a.json") || loaded.RemoveFile("a.json") {
+		t.Fatal("removing a.json twice did not succeed exactly once")
+	}
+	if _, ok := loaded.Song(11); ok {
+		t.Error("removed song still has its ID")
+	}
+	if got, ok := loaded.Song(12); !ok || got != c {
+		t.Errorf("song 12 is %+v after removing song 11, was %+v", got, c)
+	}
+	os.Remove(filepath.Join(dir, "a.json"))
+	writeFingerprints(t, dir, 4)
+	os.Remove(filepath.Join(dir, "a.json"))
+	for _, name := range []string{"b.afp", "c.json", "d.afp"} {
+		if name != "d.afp" && !loaded.RemoveFile(name) {
+			t.Fatalf("%s not indexed", name)
+		}
+		fp, err := fingerprint.Load(filepath.Join(dir, name), fingerprint.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := loaded.Add(fp, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scanned, _, _ := Scan(dir, fingerprint.DefaultParams())
+	if err := loaded.Diff(scanned); err != nil {
+		t.Errorf("updated index differs from a rebuilt one: %v", err)
+	}
+	if err := scanned.Diff(mem); err == nil {
+		t.Error("different databases reported equal")
+	}
+
+	for _, song := range loaded.Songs() {
+		if song.ID == 11 || song.ID > 14 || song.File == "b.afp" && song.ID != 10 {
+			t.Errorf("'%s' got ID %d", song.File, song.ID)
+		}
+	}
+
+	st := loaded.Stats(5)
+	total := 0
+	for _, n := range st.Buckets {
+		total += n
+	}
+	if st.Songs != 3 || total != st.Hashes || len(st.Crowded) != 5 || st.Crowded[0].Postings < st.Crowded[4].Postings {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+func TestScanAfterConvert(t *testing.T) {
+	dir := t.TempDir()
+	writeFingerprints(t, dir, 4)
+	before, _, err := Scan(dir, fingerprint.DefaultParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := fingerprint.Glob(dir)
+	for _, file := range files {
+		fp, err := fingerprint.Load(file, fingerprint.Params{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fingerprint.Convert(fp, file, dir, fingerprint.BinaryExt, false, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	converted := filepath.Join(dir, "b"+fingerprint.BinaryExt)
+	fp, err := fingerprint.Load(converted, fingerprint.Params{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fingerprint.Convert(fp, converted, dir, fingerprint.JSONExt, false, true); !errors.Is(err, fingerprint.ErrBothFormats) {
+		t.Fatalf("keeping the source next to its conversion: got %v, want ErrBothFormats", err)
+	}
+
+	if files, _ := fingerprint.Glob(dir); len(files) != 4 {
+		t.Fatalf("converted directory holds %v, want 4 fingerprints", files)
+	}
+	after, skipped, err := Scan(dir, fingerprint.DefaultParams())
+	if err != nil || len(skipped) > 0 {
+		t.Fatalf("rescan: %v, skipped %v", err, skipped)
+	}
+	if len(after.Songs()) != len(before.Songs()) {
+		t.Fatalf("rescan indexed %d songs, want %d", len(after.Songs()), len(before.Songs()))
+	}
+	for _, want := range before.Songs() {
+		got, ok := after.Song(want.ID)
+		if !ok || got.Name != want.Name || got.Hashes != want.Hashes {
+			t.Errorf("song %d is %+v after converting, was %+v", want.ID, got, want)
+		}
+	}
+}
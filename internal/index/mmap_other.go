@@ -0,0 +1,20 @@
+//go:build !unix
+
+package index
+
+import "os"
+
+// mapping is the contents of an index file. Without mmap it is read whole.
+type mapping []byte
+
+func mapFile(path string) (mapping, error) {
+	return os.ReadFile(path)
+}
+
+func (m mapping) bytes() []byte {
+	return m
+}
+
+func (m mapping) unmap() error {
+	return nil
+}
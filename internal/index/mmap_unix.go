@@ -0,0 +1,43 @@
+//go:build unix
+
+package index
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapping is the contents of an index file, mapped into memory.
+type mapping []byte
+
+func mapFile(path string) (mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return mapping{}, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return mapping(data), nil
+}
+
+func (m mapping) bytes() []byte {
+	return m
+}
+
+func (m mapping) unmap() error {
+	if len(m) == 0 {
+		return nil
+	}
+	return syscall.Munmap(m)
+}
@@ -0,0 +1,110 @@
+package index
+
+import (
+	"cmp"
+	"fmt"
+	"math/bits"
+	"slices"
+)
+
+// Stats summarises how the postings of an index are spread over its hashes.
+type Stats struct {
+	Songs    int
+	Hashes   int
+	Postings int
+	// Buckets[i] counts the hashes with 2^i to 2^(i+1)-1 postings.
+	Buckets []int
+	// Crowded are the hashes with the most postings, most crowded first.
+	Crowded []Bucket
+}
+
+// Bucket is the posting list of one hash.
+type Bucket struct {
+	Hash     uint32
+	Postings int
+	Songs    int
+}
+
+// Stats reports the distribution of postings and the top most crowded
+// hashes.
+func (m *Memory) Stats(top int) Stats {
+	st := Stats{Songs: len(m.songs), Hashes: len(m.postings)}
+
+	var crowded []Bucket
+	for hash, list := range m.postings {
+		st.Postings += len(list)
+		b := bits.Len(uint(len(list))) - 1
+		for len(st.Buckets) <= b {
+			st.Buckets = append(st.Buckets, 0)
+		}
+		st.Buckets[b]++
+		crowded = append(crowded, Bucket{Hash: hash, Postings: len(list)})
+	}
+
+	slices.SortFunc(crowded, func(a, b Bucket) int {
+		return cmp.Or(cmp.Compare(b.Postings, a.Postings), cmp.Compare(a.Hash, b.Hash))
+	})
+	st.Crowded = crowded[:min(top, len(crowded))]
+	for i := range st.Crowded {
+		songs := make(map[uint32]bool)
+		for _, p := range m.postings[st.Crowded[i].Hash] {
+			songs[p.song] = true
+		}
+		st.Crowded[i].Songs = len(songs)
+	}
+	return st
+}
+
+// Diff reports the first difference between the songs and postings of m and
+// other, matching songs by their fingerprint file, or nil if they hold the
+// same data.
+func (m *Memory) Diff(other *Memory) error {
+	if len(m.songs) != len(other.songs) {
+		return fmt.Errorf("%d songs, expected %d", len(m.songs), len(other.songs))
+	}
+	ids := make(map[string]uint32, len(other.songs))
+	for _, s := range other.songs {
+		ids[s.File] = s.ID
+	}
+	// remap translates the song IDs of m into those of other.
+	remap := make(map[uint32]uint32, len(m.songs))
+	for _, s := range m.songs {
+		id, ok := ids[s.File]
+		if !ok {
+			return fmt.Errorf("'%s' should not be indexed", s.File)
+		}
+		if o, _ := other.Song(id); s.Name != o.Name || s.Hashes != o.Hashes {
+			return fmt.Errorf("'%s' is indexed as %q with %d hashes, expected %q with %d", s.File, s.Name, s.Hashes, o.Name, o.Hashes)
+		}
+		remap[s.ID] = id
+	}
+
+	if len(m.postings) != len(other.postings) {
+		return fmt.Errorf("%d distinct hashes, expected %d", len(m.postings), len(other.postings))
+	}
+	order := func(a, b posting) int {
+		return cmp.Or(cmp.Compare(a.song, b.song), cmp.Compare(a.frame, b.frame))
+	}
+	for hash, list := range m.postings {
+		want := other.postings[hash]
+		if len(list) != len(want) {
+			return fmt.Errorf("hash %08x has %d postings, expected %d", hash, len(list), len(want))
+		}
+		got := make([]posting, len(list))
+		for i, p := range list {
+			got[i] = posting{song: remap[p.song], frame: p.frame}
+		}
+		want = slices.Clone(want)
+		slices.SortFunc(got, order)
+		slices.SortFunc(want, order)
+		for i := range got {
+			if got[i] != want[i] {
+				gotSong, _ := other.Song(got[i].song)
+				wantSong, _ := other.Song(want[i].song)
+				return fmt.Errorf("hash %08x: posting of '%s' at frame %d, expected '%s' at frame %d",
+					hash, gotSong.File, got[i].frame, wantSong.File, want[i].frame)
+			}
+		}
+	}
+	return nil
+}
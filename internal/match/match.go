@@ -0,0 +1,416 @@
+// Package match ranks the songs of an index by how many of a query's
+// landmarks line up with theirs at a single time offset.
+package match
+
+import (
+	"audateci/internal/index"
+	"audateci/internal/signal"
+	"cmp"
+	"math"
+	"slices"
+)
+
+const (
+	// DefaultFPR is the false-positive rate matches are accepted at unless
+	// asked otherwise.
+	DefaultFPR = 1e-3
+	// MinScore is the fewest aligned hashes a match can rest on. The null
+	// model takes hits as independent, which a handful of hits from one
+	// repeated phrase are not.
+	MinScore = 5
+	// binWidth is the width of the offset histogram bins, in seconds.
+	binWidth = 0.1
+)
+
+// Options tune Rank.
+type Options struct {
+	// Top is the number of candidates returned.
+	Top int
+	// FPR is the highest false-alarm probability accepted as a match.
+	FPR float64
+	// Speeds are the playback speeds RankSpeeds tries, only 1 when empty.
+	Speeds []float64
+	// FreqTol is the number of frequency bins the peaks of a hash may be off
+	// by and still vote, with a weight falling off with the distance.
+	FreqTol int
+}
+
+// Candidate is a song that shares hashes with the query.
+type Candidate struct {
+	Song index.Song
+	// Offset is the time in the song the query starts at, in seconds, and
+	// OffsetErr its standard error.
+	Offset    float64
+	OffsetErr float64
+	// Speed is the playback speed of the query relative to the song: 1.05
+	// when it plays 5% faster, pitched up by as much.
+	Speed float64
+	// Score is the number of query hashes that line up at Offset, counting
+	// the neighbouring 0.1s bins. Hashes found in neighbouring frequency
+	// bins count for less than one.
+	Score float64
+	// Ratio is Score over the score of the next candidate, or over 1 when
+	// there is none.
+	Ratio float64
+	// Normalized is the percentage of the query's hashes that line up, which
+	// unlike Score does not grow with the length of the query.
+	Normalized float64
+	// FalseAlarm is the probability that a query unrelated to every song of
+	// the index still gets a candidate scoring at least Score.
+	FalseAlarm float64
+	// Match is the verdict on the candidate: FalseAlarm is within the
+	// requested false-positive rate.
+	Match bool
+}
+
+// Histogram looks every query hash up in idx and adds up, per song ID, the
+// votes at each time offset in 0.1s bins. With a frequency tolerance, the
+// hashes whose peaks are up to freqTol bins off vote too, with the weight of
+// the farthest one, and only the best vote of a query hash for an offset
+// counts.
+func Histogram(query []signal.Landmark, idx index.Index, freqTol int) map[uint32]map[int]float64 {
+	votes := make(map[uint32]map[int]float64)
+	vote := func(song uint32, bin int, weight float64) {
+		if votes[song] == nil {
+			votes[song] = make(map[int]float64)
+		}
+		votes[song][bin] += weight
+	}
+
+	type key struct {
+		song uint32
+		bin  int
+	}
+	best := make(map[key]float64)
+	for _, l := range query {
+		if freqTol <= 0 {
+			idx.Lookup(l.Hash, func(song uint32, timeSec float64) {
+				vote(song, int(math.Round((timeSec-l.TimeSec)/binWidth)), 1)
+			})
+			continue
+		}
+
+		clear(best)
+		probe(l.Hash, freqTol, func(hash uint32, weight float64) {
+			idx.Lookup(hash, func(song uint32, timeSec float64) {
+				k := key{song, int(math.Round((timeSec - l.TimeSec) / binWidth))}
+				best[k] = max(best[k], weight)
+			})
+		})
+		for k, weight := range best {
+			vote(k.song, k.bin, weight)
+		}
+	}
+	return votes
+}
+
+// probe calls fn with every hash whose anchor and target bins are within tol
+// of those of hash, weighted 1 for hash itself down to 1/(tol+1) for the
+// farthest ones. Bins wrap around like in HashPair, so the neighbours of a
+// wrapped bin are found too.
+func probe(hash uint32, tol int, fn func(hash uint32, weight float64)) {
+	anchor, target, delta := signal.SplitHash(hash)
+	for da := -tol; da <= tol; da++ {
+		for dt := -tol; dt <= tol; dt++ {
+			d := max(abs(da), abs(dt))
+			fn(signal.HashPair(anchor+da, target+dt, delta), 1-float64(d)/float64(tol+1))
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Rank scores every song that shares hashes with the query by its tallest
+// offset bin, counting its two neighbours, and returns the opts.Top best
+// songs, highest score first.
+func Rank(query []signal.Landmark, idx index.Index, opts Options) []Candidate {
+	return rank([]ranking{score(query, idx, 1, opts.FreqTol)}, idx, opts)
+}
+
+// ranking is the score of every song for the query at one speed, with the
+// background its false alarms are measured against.
+type ranking struct {
+	candidates []Candidate
+	model      []background
+	query      []signal.Landmark
+	freqTol    int
+}
+
+// score fills the song, offset and score of a candidate per song sharing
+// hashes with the query, the query played at speed.
+func score(query []signal.Landmark, idx index.Index, speed float64, freqTol int) ranking {
+	votes := Histogram(query, idx, freqTol)
+
+	r := ranking{
+		candidates: make([]Candidate, 0, len(votes)),
+		model:      make([]background, 0, len(votes)),
+		query:      query,
+		freqTol:    freqTol,
+	}
+	queryLength := 0.0
+	for _, l := range query {
+		queryLength = max(queryLength, l.TimeSec)
+	}
+
+	for id, bins := range votes {
+		score, bestBin, lastBin, hits := 0.0, 0, 0, 0.0
+		for bin, count := range bins {
+			s := count + bins[bin-1] + bins[bin+1]
+			if s > score || s == score && bin < bestBin {
+				score, bestBin = s, bin
+			}
+			lastBin = max(lastBin, bin)
+			hits += count
+		}
+		song, _ := idx.Song(id)
+		r.candidates = append(r.candidates, Candidate{
+			Song:       song,
+			Offset:     float64(bestBin) * binWidth,
+			Speed:      speed,
+			Score:      score,
+			Normalized: 100 * score / float64(len(query)),
+		})
+
+		// Offsets range from the query starting before the song to it
+		// starting at its end, songs indexed without their duration are
+		// taken to end at their last hit.
+		length := max(song.Duration, float64(lastBin)*binWidth)
+		b := background{song: id, hits: hits, windows: int(math.Ceil((length+queryLength)/binWidth)) + 1}
+		b.squares = windowSquares(bins, bestBin)
+		r.model = append(r.model, b)
+	}
+	return r
+}
+
+// rank keeps the best scoring speed of every song over the rankings and
+// returns the opts.Top best songs. Their false-alarm probability accounts for
+// every ranking being a chance for an unrelated query to score high.
+func rank(rankings []ranking, idx index.Index, opts Options) []Candidate {
+	type scored struct {
+		Candidate
+		r *ranking
+	}
+	best := make(map[uint32]scored)
+	for i := range rankings {
+		for _, c := range rankings[i].candidates {
+			if b, ok := best[c.Song.ID]; !ok || c.Score > b.Score {
+				best[c.Song.ID] = scored{c, &rankings[i]}
+			}
+		}
+	}
+
+	ranked := make([]scored, 0, len(best))
+	for _, c := range best {
+		ranked = append(ranked, c)
+	}
+	slices.SortFunc(ranked, func(a, b scored) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.Song.ID, b.Song.ID))
+	})
+
+	candidates := make([]Candidate, 0, min(max(opts.Top, 1), len(ranked)))
+	for i, c := range ranked[:cap(candidates)] {
+		runnerUp := 0.0
+		if i+1 < len(ranked) {
+			runnerUp = ranked[i+1].Score
+		}
+		c.Ratio = c.Score / max(runnerUp, 1)
+
+		fa := falseAlarm(c.Score, c.Song.ID, c.r.model, dispersion(c.r.model))
+		c.FalseAlarm = max(0, -math.Expm1(float64(len(rankings))*math.Log1p(-fa)))
+		c.Match = c.FalseAlarm <= opts.FPR && c.Score >= MinScore
+		refine(&c.Candidate, c.r.query, idx, c.r.freqTol)
+		candidates = append(candidates, c.Candidate)
+	}
+	return candidates
+}
+
+// refine moves the offset of c from its 0.1s bin to the centroid of the hits
+// around it. Landmark times are whole STFT frames, so the hits of the true
+// offset spread over the two frames around it, more on the nearest. Its
+// standard error takes the hits as independent, each off by up to half a
+// frame.
+func refine(c *Candidate, query []signal.Landmark, idx index.Index, freqTol int) {
+	step := idx.Params().Pairing().TimeStep
+	bin := int(math.Round(c.Offset / binWidth))
+
+	type hit struct{ offset, weight float64 }
+	var hits []hit
+	frames := make(map[int]float64)
+	for _, l := range query {
+		probe(l.Hash, freqTol, func(hash uint32, weight float64) {
+			idx.Lookup(hash, func(song uint32, timeSec float64) {
+				d := timeSec - l.TimeSec
+				if song != c.Song.ID || abs(int(math.Round(d/binWidth))-bin) > 1 {
+					return
+				}
+				hits = append(hits, hit{d, weight})
+				frames[int(math.Round(d/step))] += weight
+			})
+		})
+	}
+	if len(hits) == 0 {
+		return
+	}
+
+	peak := int(math.Round(hits[0].offset / step))
+	for f, w := range frames {
+		if w > frames[peak] || w == frames[peak] && f < peak {
+			peak = f
+		}
+	}
+	sum, squares, total := 0.0, 0.0, 0.0
+	for _, h := range hits {
+		if abs(int(math.Round(h.offset/step))-peak) <= 1 {
+			sum += h.weight * h.offset
+			squares += h.weight * h.offset * h.offset
+			total += h.weight
+		}
+	}
+	mean := sum / total
+	variance := max(squares/total-mean*mean, 0)
+	c.Offset = mean
+	c.OffsetErr = math.Sqrt((variance + step*step/12) / total)
+}
+
+// background describes the hits of the query on one song under the null
+// hypothesis that the query did not come from it: they fall uniformly over
+// the windows of three offset bins that a score is counted in.
+type background struct {
+	song    uint32
+	hits    float64
+	windows int
+	// squares is the sum of the squared window heights, leaving out the
+	// tallest window.
+	squares float64
+}
+
+// windowSquares sums the squared heights of the windows centered on every
+// bin, but the ones overlapping the window at best.
+func windowSquares(bins map[int]float64, best int) float64 {
+	centers := make(map[int]bool, 3*len(bins))
+	for bin := range bins {
+		centers[bin-1], centers[bin], centers[bin+1] = true, true, true
+	}
+	squares := 0.0
+	for c := range centers {
+		if c >= best-2 && c <= best+2 {
+			continue
+		}
+		h := bins[c-1] + bins[c] + bins[c+1]
+		squares += h * h
+	}
+	return squares
+}
+
+// dispersion is the variance of the window heights over their mean, pooled
+// over every song. Hits come in clusters, landmarks sharing an anchor peak
+// tend to line up together, so it is above the 1 of independent hits.
+func dispersion(model []background) float64 {
+	variance, mean := 0.0, 0.0
+	for _, b := range model {
+		m := 3 * b.hits / float64(b.windows)
+		variance += b.squares - float64(b.windows)*m*m
+		mean += float64(b.windows) * m
+	}
+	if mean == 0 {
+		return 1
+	}
+	return max(1, variance/mean)
+}
+
+// falseAlarm is the probability that, with no song related to the query, at
+// least one of them scores score or more. The hits aligned at the
+// candidate's own offset are left out of its song's background. Weighted
+// scores are rounded down, which errs on the side of a false alarm.
+//
+// In a song with h background hits over w windows, a window holds 3h/w hits
+// on average with the pooled dispersion d, modelled as a negative binomial
+// (Poisson when d is 1), and the tallest one reaches score with
+// probability 1-(1-P(X >= score))^w, taking windows as independent.
+func falseAlarm(score float64, song uint32, model []background, d float64) float64 {
+	k := int(math.Floor(score + 1e-9))
+	logNone := 0.0
+	for _, b := range model {
+		hits := b.hits
+		if b.song == song {
+			hits -= score
+		}
+		mean := 3 * max(hits, 0) / float64(b.windows)
+		var tail float64
+		if d > 1 {
+			tail = negBinomialTail(k, mean/(d-1), 1/d)
+		} else {
+			tail = poissonTail(k, mean)
+		}
+		logNone += float64(b.windows) * math.Log1p(-tail)
+	}
+	return max(0, -math.Expm1(logNone))
+}
+
+// negBinomialTail is P(X >= k) for X the number of failures before r
+// successes of probability p, whose mean is r(1-p)/p.
+func negBinomialTail(k int, r, p float64) float64 {
+	if k <= 0 {
+		return 1
+	}
+	if r <= 0 {
+		return 0
+	}
+
+	term := math.Pow(p, r)
+	if float64(k) <= r*(1-p)/p {
+		cdf := 0.0
+		for i := range k {
+			cdf += term
+			term *= (float64(i) + r) / float64(i+1) * (1 - p)
+		}
+		return max(0, 1-cdf)
+	}
+
+	lk, _ := math.Lgamma(float64(k) + r)
+	lr, _ := math.Lgamma(r)
+	lf, _ := math.Lgamma(float64(k + 1))
+	term = math.Exp(lk - lr - lf + r*math.Log(p) + float64(k)*math.Log1p(-p))
+	tail := 0.0
+	for i := k; term > tail*1e-16; i++ {
+		tail += term
+		term *= (float64(i) + r) / float64(i+1) * (1 - p)
+	}
+	return min(tail, 1)
+}
+
+// poissonTail is P(X >= k) for X ~ Poisson(lambda).
+func poissonTail(k int, lambda float64) float64 {
+	if k <= 0 {
+		return 1
+	}
+	if lambda <= 0 {
+		return 0
+	}
+
+	// Below the mean the tail is large and 1 - P(X < k) is accurate,
+	// above it summing the tail avoids the cancellation.
+	term := math.Exp(-lambda)
+	if float64(k) <= lambda {
+		cdf := 0.0
+		for i := range k {
+			cdf += term
+			term *= lambda / float64(i+1)
+		}
+		return max(0, 1-cdf)
+	}
+
+	lg, _ := math.Lgamma(float64(k + 1))
+	term = math.Exp(-lambda + float64(k)*math.Log(lambda) - lg)
+	tail := 0.0
+	for i := k; term > tail*1e-16; i++ {
+		tail += term
+		term *= lambda / float64(i+1)
+	}
+	return min(tail, 1)
+}
@@ -0,0 +1,275 @@
+package match
+
+import (
+	"audateci/internal/fingerprint"
+	"audateci/internal/index"
+	"audateci/internal/signal"
+	"cmp"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func randomPoints(rng *rand.Rand, frames int, step signal.Pairing) []signal.KeyPoint {
+	var points []signal.KeyPoint
+	for frame := range frames {
+		for range 3 {
+			points = append(points, signal.KeyPoint{
+				TimeSec: float64(frame) * step.TimeStep,
+				FreqHz:  float64(20+rng.Intn(400)) * step.FreqStep,
+			})
+		}
+	}
+	return points
+}
+
+func TestRank(t *testing.T) {
+	params := fingerprint.DefaultParams()
+	step := params.Pairing()
+	rng := rand.New(rand.NewSource(1))
+
+	idx := index.NewMemory(params)
+	songs := make([][]signal.KeyPoint, 4)
+	for i := range songs {
+		songs[i] = randomPoints(rng, 2000, step)
+		fp := &fingerprint.File{Version: fingerprint.Version, Filename: string(rune('a' + i)), Params: params, Points: songs[i]}
+		fp.Hashes = signal.GetLandmarks(fp.Points, step)
+		if err := idx.Add(fp, fp.Filename+".json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The query is 300 frames of song c from frame 500 on, with half its
+	// points lost and as many spurious ones.
+	var query []signal.KeyPoint
+	start := 500 * step.TimeStep
+	for _, p := range songs[2] {
+		if p.TimeSec >= start && p.TimeSec < start+300*step.TimeStep && rng.Intn(2) == 0 {
+			p.TimeSec -= start
+			query = append(query, p)
+		}
+	}
+	query = append(query, randomPoints(rng, 300, step)...)
+	landmarks := signal.GetLandmarks(query, step)
+
+	ranked := Rank(landmarks, idx, Options{Top: 3, FPR: DefaultFPR})
+	if len(ranked) != 3 {
+		t.Fatalf("got %d candidates, want 3", len(ranked))
+	}
+	best := ranked[0]
+	if best.Song.Name != "c" || math.Abs(best.Offset-start) > 0.1 || !best.Match || best.Ratio < 5 || best.FalseAlarm > 1e-9 {
+		t.Errorf("best candidate %+v, want song c at %.2fs", best, start)
+	}
+	// The query starts on a frame of the song, so every hit agrees.
+	if math.Abs(best.Offset-start) > 1e-4 || best.OffsetErr <= 0 || best.OffsetErr > step.TimeStep/10 {
+		t.Errorf("offset %gs ± %gs, want %gs to a fraction of a frame", best.Offset, best.OffsetErr, start)
+	}
+	for _, c := range ranked[1:] {
+		if c.Match || c.Score > best.Score {
+			t.Errorf("runner-up %+v is a match", c)
+		}
+	}
+
+	// Unrelated queries should be false alarms at about the rate the model
+	// predicts.
+	const queries, fpr = 200, 0.05
+	alarms := 0
+	for range queries {
+		noise := signal.GetLandmarks(randomPoints(rng, 100+rng.Intn(400), step), step)
+		if ranked := Rank(noise, idx, Options{Top: 1, FPR: fpr}); len(ranked) > 0 && ranked[0].FalseAlarm <= fpr {
+			alarms++
+		}
+	}
+	if alarms > 2*queries*fpr {
+		t.Errorf("%d of %d unrelated queries are false alarms at a %.2f rate", alarms, queries, fpr)
+	}
+}
+
+func TestTails(t *testing.T) {
+	for _, c := range []struct {
+		k      int
+		lambda float64
+		want   float64
+	}{
+		{0, 3, 1},
+		{1, 2, 1 - math.Exp(-2)},
+		{3, 0.5, 1 - math.Exp(-0.5)*(1+0.5+0.125)},
+		{40, 2, 3.5e-37},
+		{5, 0, 0},
+	} {
+		if got := poissonTail(c.k, c.lambda); math.Abs(got-c.want) > 1e-9*c.want+1e-15 && math.Abs(got/c.want-1) > 0.05 {
+			t.Errorf("P(X >= %d | %g) = %g, want %g", c.k, c.lambda, got, c.want)
+		}
+	}
+
+	// With r = 1 the negative binomial is geometric, P(X >= k) = (1-p)^k.
+	for _, c := range []struct {
+		k int
+		p float64
+	}{{0, 0.3}, {1, 0.2}, {3, 0.5}, {60, 0.5}, {4, 0.9}} {
+		want := math.Pow(1-c.p, float64(c.k))
+		if got := negBinomialTail(c.k, 1, c.p); math.Abs(got/want-1) > 1e-9 {
+			t.Errorf("P(X >= %d | r=1, p=%g) = %g, want %g", c.k, c.p, got, want)
+		}
+	}
+}
+
+func TestRankSpeeds(t *testing.T) {
+	params := fingerprint.DefaultParams()
+	step := params.Pairing()
+	rng := rand.New(rand.NewSource(2))
+
+	idx := index.NewMemory(params)
+	songs := make([][]signal.KeyPoint, 3)
+	for i := range songs {
+		songs[i] = randomPoints(rng, 2000, step)
+		fp := &fingerprint.File{Version: fingerprint.Version, Filename: string(rune('a' + i)), Params: params, Points: songs[i]}
+		fp.Hashes = signal.GetLandmarks(fp.Points, step)
+		if err := idx.Add(fp, fp.Filename+".json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The query is song b played 4% faster from 10s on.
+	const speed, start = 1.04, 10.0
+	var query []signal.KeyPoint
+	for _, p := range songs[1] {
+		if p.TimeSec >= start && p.TimeSec < start+8 {
+			p.TimeSec = (p.TimeSec - start) / speed
+			p.FreqHz *= speed
+			query = append(query, p)
+		}
+	}
+
+	if ranked := Rank(signal.GetLandmarks(query, step), idx, Options{Top: 1, FPR: DefaultFPR}); len(ranked) > 0 && ranked[0].Match {
+		t.Errorf("matched %+v without searching speeds", ranked[0])
+	}
+
+	ranked := RankSpeeds(query, step, idx, Options{Top: 2, FPR: DefaultFPR, Speeds: Speeds(0.06, 0.01)})
+	if len(ranked) == 0 {
+		t.Fatal("no candidates")
+	}
+	best := ranked[0]
+	if best.Song.Name != "b" || !best.Match || math.Abs(best.Speed-speed) > 1e-9 || math.Abs(best.Offset-start) > 0.1 {
+		t.Errorf("best candidate %+v, want song b at %.2fs and speed %.2f", best, start, speed)
+	}
+}
+
+func TestSpeeds(t *testing.T) {
+	got := Speeds(0.03, 0.01)
+	want := []float64{1, 0.99, 1.01, 0.98, 1.02, 0.97, 1.03}
+	if !slices.Equal(got, want) {
+		t.Errorf("Speeds(0.03, 0.01) = %v, want %v", got, want)
+	}
+	if got := Speeds(0, 0.01); !slices.Equal(got, []float64{1}) {
+		t.Errorf("Speeds(0, 0.01) = %v, want [1]", got)
+	}
+}
+
+func TestRankFreqTol(t *testing.T) {
+	params := fingerprint.DefaultParams()
+	step := params.Pairing()
+	rng := rand.New(rand.NewSource(3))
+
+	idx := index.NewMemory(params)
+	songs := make([][]signal.KeyPoint, 3)
+	for i := range songs {
+		songs[i] = randomPoints(rng, 2000, step)
+		fp := &fingerprint.File{Version: fingerprint.Version, Filename: string(rune('a' + i)), Params: params, Points: songs[i]}
+		fp.Hashes = signal.GetLandmarks(fp.Points, step)
+		if err := idx.Add(fp, fp.Filename+".json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The query is 500 frames of song a from frame 1000 on, every peak a bin
+	// higher.
+	start := 1000 * step.TimeStep
+	var query []signal.KeyPoint
+	for _, p := range songs[0] {
+		if p.TimeSec >= start && p.TimeSec < start+500*step.TimeStep {
+			p.TimeSec -= start
+			p.FreqHz += step.FreqStep
+			query = append(query, p)
+		}
+	}
+	landmarks := signal.GetLandmarks(query, step)
+
+	if ranked := Rank(landmarks, idx, Options{Top: 1, FPR: DefaultFPR}); len(ranked) > 0 && ranked[0].Match {
+		t.Errorf("matched %+v without a frequency tolerance", ranked[0])
+	}
+	ranked := Rank(landmarks, idx, Options{Top: 1, FPR: DefaultFPR, FreqTol: 1})
+	if len(ranked) == 0 || ranked[0].Song.Name != "a" || !ranked[0].Match || math.Abs(ranked[0].Offset-start) > 0.1 {
+		t.Errorf("ranked %+v, want song a at %.2fs", ranked, start)
+	}
+
+	const queries, fpr = 100, 0.05
+	alarms := 0
+	for range queries {
+		noise := signal.GetLandmarks(randomPoints(rng, 100+rng.Intn(400), step), step)
+		if ranked := Rank(noise, idx, Options{Top: 1, FPR: fpr, FreqTol: 1}); len(ranked) > 0 && ranked[0].Match {
+			alarms++
+		}
+	}
+	if alarms > 2*queries*fpr {
+		t.Errorf("%d of %d unrelated queries are false alarms at a %.2f rate with a tolerance", alarms, queries, fpr)
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	params := fingerprint.DefaultParams()
+	step := params.Pairing()
+	rng := rand.New(rand.NewSource(4))
+
+	idx := index.NewMemory(params)
+	songs := make([][]signal.KeyPoint, 3)
+	for i := range songs {
+		songs[i] = randomPoints(rng, 3000, step)
+		fp := &fingerprint.File{Version: fingerprint.Version, Filename: string(rune('a' + i)), Params: params, Points: songs[i]}
+		fp.Hashes = signal.GetLandmarks(fp.Points, step)
+		if err := idx.Add(fp, fp.Filename+".json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 40s of song a from 10s on, 20s of noise and then song b from its
+	// start, all on frame boundaries.
+	frames := func(sec float64) float64 { return math.Round(sec/step.TimeStep) * step.TimeStep }
+	var query []signal.KeyPoint
+	excerpt := func(song []signal.KeyPoint, from, length, at float64) {
+		for _, p := range song {
+			if p.TimeSec >= from && p.TimeSec < from+length {
+				p.TimeSec += at - from
+				query = append(query, p)
+			}
+		}
+	}
+	excerpt(songs[0], frames(10), frames(40), 0)
+	for _, p := range randomPoints(rng, int(20/step.TimeStep), step) {
+		p.TimeSec += frames(40)
+		query = append(query, p)
+	}
+	bStart := frames(40) + frames(20)
+	excerpt(songs[1], 0, frames(30), bStart)
+	slices.SortStableFunc(query, func(a, b signal.KeyPoint) int { return cmp.Compare(a.TimeSec, b.TimeSec) })
+
+	duration := bStart + frames(30)
+	segments := Timeline(query, duration, step, idx, Options{FPR: DefaultFPR}, 10, 5)
+	if len(segments) != 3 {
+		t.Fatalf("got %d segments, want 3: %+v", len(segments), segments)
+	}
+	a, gap, b := segments[0], segments[1], segments[2]
+	if !a.Identified || a.Song.Name != "a" || a.Start != 0 || math.Abs(a.Offset-frames(10)) > 0.1 {
+		t.Errorf("first segment %+v, want song a from 10s", a)
+	}
+	if gap.Identified || gap.Start != a.End || gap.End != b.Start {
+		t.Errorf("second segment %+v, want an unidentified gap", gap)
+	}
+	if !b.Identified || b.Song.Name != "b" || math.Abs(b.Start-bStart) > 5 || math.Abs(b.Offset-(b.Start-bStart)) > 0.1 || b.End != duration {
+		t.Errorf("last segment %+v, want song b from %.2fs", b, bStart)
+	}
+	if math.Abs(a.End-frames(40)) > 5 {
+		t.Errorf("song a ends at %.2fs, want about 40s", a.End)
+	}
+}
@@ -0,0 +1,52 @@
+package match
+
+import (
+	"audateci/internal/index"
+	"audateci/internal/signal"
+	"math"
+)
+
+// Speeds returns the playback speeds from 1-span to 1+span in steps of step,
+// nearest to 1 first.
+func Speeds(span, step float64) []float64 {
+	speeds := []float64{1}
+	if span <= 0 || step <= 0 {
+		return speeds
+	}
+	for i := 1; float64(i)*step <= span+1e-9; i++ {
+		d := math.Round(float64(i)*step*1e6) / 1e6
+		speeds = append(speeds, 1-d, 1+d)
+	}
+	return speeds
+}
+
+// AtSpeed maps the key points of a query played back at speed to the times
+// and frequencies they have in the song: playing a song at speed s scales its
+// times by 1/s and its frequencies by s.
+func AtSpeed(points []signal.KeyPoint, speed float64) []signal.KeyPoint {
+	scaled := make([]signal.KeyPoint, len(points))
+	for i, p := range points {
+		p.TimeSec *= speed
+		p.FreqHz /= speed
+		scaled[i] = p
+	}
+	return scaled
+}
+
+// RankSpeeds ranks the songs for the query key points played back at each of
+// opts.Speeds, keeping the speed every song scores best at.
+//
+// Landmarks stand up to a mismatch of about half a frequency bin in their
+// highest peak, so that speeds should be no further apart than 1%.
+func RankSpeeds(points []signal.KeyPoint, pairing signal.Pairing, idx index.Index, opts Options) []Candidate {
+	speeds := opts.Speeds
+	if len(speeds) == 0 {
+		speeds = []float64{1}
+	}
+	rankings := make([]ranking, 0, len(speeds))
+	for _, speed := range speeds {
+		query := signal.GetLandmarks(AtSpeed(points, speed), pairing)
+		rankings = append(rankings, score(query, idx, speed, opts.FreqTol))
+	}
+	return rank(rankings, idx, opts)
+}
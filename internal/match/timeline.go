@@ -0,0 +1,104 @@
+package match
+
+import (
+	"audateci/internal/index"
+	"audateci/internal/signal"
+	"math"
+	"sort"
+)
+
+// maxDrift is how far, in seconds, the offset of a window may stray from
+// where the previous one predicts and still continue its segment.
+const maxDrift = 0.5
+
+// Segment is a stretch of a long query that plays one song through, or that
+// no song was identified in.
+type Segment struct {
+	// Start and End are the times the segment spans in the query, in
+	// seconds.
+	Start float64
+	End   float64
+	// Identified is false for the stretches where no window matched, which
+	// leave the fields below zero.
+	Identified bool
+	Song       index.Song
+	// Offset is the time in the song at Start, in seconds.
+	Offset float64
+	Speed  float64
+	// Score and FalseAlarm are those of the best window of the segment.
+	Score      float64
+	FalseAlarm float64
+}
+
+// Timeline slides a window of the given length over the key points of a
+// query lasting duration seconds, in steps of hop, and ranks every window
+// against idx. Consecutive windows matching the same song at consistent
+// offsets are merged into a segment, as are consecutive windows without a
+// match. Every window stands for the hop it starts, the last one for the
+// rest of the query, so the segments tile it.
+func Timeline(points []signal.KeyPoint, duration float64, pairing signal.Pairing, idx index.Index, opts Options, window, hop float64) []Segment {
+	opts.Top = 1
+	var segments []Segment
+	for w := range max(1, int(math.Round(duration/hop))) {
+		start := float64(w) * hop
+		first := sort.Search(len(points), func(i int) bool { return points[i].TimeSec >= start })
+		last := sort.Search(len(points), func(i int) bool { return points[i].TimeSec >= start+window })
+		shifted := make([]signal.KeyPoint, 0, last-first)
+		for _, p := range points[first:last] {
+			p.TimeSec -= start
+			shifted = append(shifted, p)
+		}
+
+		s := Segment{Start: start, End: min(start+hop, duration)}
+		if ranked := RankSpeeds(shifted, pairing, idx, opts); len(ranked) > 0 && ranked[0].Match {
+			c := ranked[0]
+			s = Segment{
+				Start:      s.Start,
+				End:        s.End,
+				Identified: true,
+				Song:       c.Song,
+				Offset:     c.Offset,
+				Speed:      c.Speed,
+				Score:      c.Score,
+				FalseAlarm: c.FalseAlarm,
+			}
+		}
+		segments = extend(segments, s)
+	}
+	if len(segments) > 0 {
+		segments[len(segments)-1].End = duration
+	}
+	return segments
+}
+
+// extend appends the segment of one window to segments, merging it into the
+// last one when they are both unidentified or play the same song at the
+// offsets the song advancing between them predicts. A song starting within
+// the window starts its segment.
+func extend(segments []Segment, s Segment) []Segment {
+	if s.Identified && s.Offset < 0 {
+		s.Start -= s.Offset / s.Speed
+		s.End = max(s.End, s.Start)
+		s.Offset = 0
+	}
+	if len(segments) == 0 {
+		if s.Start > 0 {
+			segments = append(segments, Segment{End: s.Start})
+		}
+		return append(segments, s)
+	}
+	last := &segments[len(segments)-1]
+	switch {
+	case !last.Identified && !s.Identified:
+	case last.Identified && s.Identified && last.Song.ID == s.Song.ID &&
+		math.Abs(last.Offset+(s.Start-last.Start)*last.Speed-s.Offset) <= maxDrift:
+		if s.Score > last.Score {
+			last.Score, last.FalseAlarm = s.Score, s.FalseAlarm
+		}
+	default:
+		last.End = s.Start
+		return append(segments, s)
+	}
+	last.End = s.End
+	return segments
+}
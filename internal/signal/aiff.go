@@ -0,0 +1,231 @@
+package signal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// aiffDecoder reads uncompressed AIFF and AIFF-C files, including the
+// little-endian 'sowt' and floating point 'fl32'/'fl64' AIFF-C variants.
+type aiffDecoder struct {
+	rs           io.ReadSeeker
+	r            *bufio.Reader
+	dataOffset   int64
+	sampleRate   int
+	channels     int
+	bitDepth     int
+	numFrames    int64
+	framesRead   int64
+	littleEndian bool
+	float        bool
+	frameBuf     []byte
+}
+
+func newAIFFDecoder(rs io.ReadSeeker) (*aiffDecoder, error) {
+	var form [12]byte
+	if _, err := io.ReadFull(rs, form[:]); err != nil {
+		return nil, err
+	}
+	if string(form[0:4]) != "FORM" || (string(form[8:12]) != "AIFF" && string(form[8:12]) != "AIFC") {
+		return nil, fmt.Errorf("invalid aiff file")
+	}
+	isAIFC := string(form[8:12]) == "AIFC"
+
+	d := &aiffDecoder{rs: rs}
+	foundComm := false
+	dataOffset := int64(-1)
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(rs, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+		id := string(header[0:4])
+		size := int64(binary.BigEndian.Uint32(header[4:8]))
+		next := size + size%2
+
+		switch id {
+		case "COMM":
+			body := make([]byte, size)
+			if _, err := io.ReadFull(rs, body); err != nil {
+				return nil, err
+			}
+			if err := d.parseComm(body, isAIFC); err != nil {
+				return nil, err
+			}
+			foundComm = true
+			next -= size
+		case "SSND":
+			var ssnd [8]byte
+			if _, err := io.ReadFull(rs, ssnd[:]); err != nil {
+				return nil, err
+			}
+			pos, err := rs.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			dataOffset = pos + int64(binary.BigEndian.Uint32(ssnd[0:4]))
+			next -= 8
+		}
+
+		if _, err := rs.Seek(next, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	if !foundComm || dataOffset < 0 {
+		return nil, fmt.Errorf("aiff file is missing its COMM or SSND chunk")
+	}
+	d.dataOffset = dataOffset
+	d.frameBuf = make([]byte, d.channels*d.bytesPerSample())
+	if err := d.seekFrame(0); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *aiffDecoder) parseComm(body []byte, isAIFC bool) error {
+	if len(body) < 18 {
+		return fmt.Errorf("aiff COMM chunk too short")
+	}
+
+	d.channels = int(binary.BigEndian.Uint16(body[0:2]))
+	d.numFrames = int64(binary.BigEndian.Uint32(body[2:6]))
+	d.bitDepth = int(binary.BigEndian.Uint16(body[6:8]))
+	d.sampleRate = int(math.Round(decodeExtended(body[8:18])))
+
+	if isAIFC && len(body) >= 22 {
+		switch compression := string(body[18:22]); compression {
+		case "NONE", "twos":
+		case "sowt":
+			d.littleEndian = true
+		case "fl32", "FL32":
+			d.float, d.bitDepth = true, 32
+		case "fl64", "FL64":
+			d.float, d.bitDepth = true, 64
+		default:
+			return fmt.Errorf("unsupported aiff-c compression '%s'", compression)
+		}
+	}
+
+	if d.channels < 1 || d.sampleRate < 1 || d.bitDepth < 1 || d.bitDepth > 64 {
+		return fmt.Errorf("invalid aiff format: %d channels, %d Hz, %d bits", d.channels, d.sampleRate, d.bitDepth)
+	}
+	return nil
+}
+
+// decodeExtended converts an 80-bit IEEE 754 extended precision number.
+func decodeExtended(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b[0:2]))
+	mantissa := binary.BigEndian.Uint64(b[2:10])
+
+	sign := 1.0
+	if exponent&0x8000 != 0 {
+		sign = -1
+	}
+	exponent &= 0x7fff
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+
+	return sign * math.Ldexp(float64(mantissa), exponent-16383-63)
+}
+
+func (d *aiffDecoder) bytesPerSample() int {
+	return (d.bitDepth + 7) / 8
+}
+
+func (d *aiffDecoder) SampleRate() int {
+	return d.sampleRate
+}
+
+func (d *aiffDecoder) Channels() int {
+	return d.channels
+}
+
+func (d *aiffDecoder) Length() int64 {
+	return d.numFrames
+}
+
+func (d *aiffDecoder) Seek(offset int64, whence int) (int64, error) {
+	frame, err := seekTarget(offset, whence, d.framesRead, d.numFrames)
+	if err != nil {
+		return 0, err
+	}
+	return frame, d.seekFrame(frame)
+}
+
+func (d *aiffDecoder) seekFrame(frame int64) error {
+	if _, err := d.rs.Seek(d.dataOffset+frame*int64(len(d.frameBuf)), io.SeekStart); err != nil {
+		return err
+	}
+	if d.r == nil {
+		d.r = bufio.NewReaderSize(d.rs, 64*1024)
+	} else {
+		d.r.Reset(d.rs)
+	}
+	d.framesRead = frame
+	return nil
+}
+
+func (d *aiffDecoder) Read(frames [][]float64) (int, error) {
+	width := d.bytesPerSample()
+	scale := math.Ldexp(1, width*8-1)
+
+	n := 0
+	for n < len(frames[0]) {
+		if d.framesRead >= d.numFrames {
+			if n == 0 {
+				return 0, io.EOF
+			}
+			break
+		}
+		if _, err := io.ReadFull(d.r, d.frameBuf); err != nil {
+			if n > 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+				break
+			}
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return n, err
+		}
+
+		for ch := range frames {
+			raw := d.frameBuf[ch*width : (ch+1)*width]
+			frames[ch][n] = d.decodeSample(raw, scale)
+		}
+		d.framesRead++
+		n++
+	}
+
+	return n, nil
+}
+
+func (d *aiffDecoder) decodeSample(raw []byte, scale float64) float64 {
+	if d.float {
+		if len(raw) == 4 {
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(raw)))
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw))
+	}
+
+	var v uint64
+	if d.littleEndian {
+		for i := len(raw) - 1; i >= 0; i-- {
+			v = v<<8 | uint64(raw[i])
+		}
+	} else {
+		for _, c := range raw {
+			v = v<<8 | uint64(c)
+		}
+	}
+
+	shift := 64 - 8*len(raw)
+	return float64(int64(v<<shift)>>shift) / scale
+}
@@ -0,0 +1,81 @@
+package signal
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Align finds the lag, within maxLag samples of guess, at which query lines
+// up best with ref, query[i] matching ref[i+lag]. The lag is refined between
+// samples by fitting a parabola through the correlation peak. corr is the
+// normalized correlation at the peak, 1 when query is an exact excerpt of
+// ref, and stdErr the standard error of lag in samples, from the curvature
+// of the peak and the noise of a correlation over len(query) samples.
+func Align(ref, query []float64, guess, maxLag int) (lag, corr, stdErr float64) {
+	if len(query) == 0 || maxLag < 1 {
+		return float64(guess), 0, math.Inf(1)
+	}
+
+	// segment holds ref from guess-maxLag on, zero outside of it.
+	lo := guess - maxLag
+	segment := make([]float64, len(query)+2*maxLag)
+	for i := range segment {
+		if j := lo + i; j >= 0 && j < len(ref) {
+			segment[i] = ref[j]
+		}
+	}
+
+	n := nextPowerOfTwo(len(segment) + len(query))
+	a := make([]complex128, n)
+	b := make([]complex128, n)
+	for i, v := range segment {
+		a[i] = complex(v, 0)
+	}
+	queryEnergy := 0.0
+	for i, v := range query {
+		b[i] = complex(v, 0)
+		queryEnergy += v * v
+	}
+	fa, fb := FFT(a), FFT(b)
+	for i := range fa {
+		fa[i] *= cmplx.Conj(fb[i])
+	}
+	raw := IFFT(fa)
+
+	// c[k] is the correlation of query with the segment from k on, divided
+	// by the energies of both.
+	c := make([]float64, 2*maxLag+1)
+	energy := 0.0
+	for _, v := range segment[:len(query)] {
+		energy += v * v
+	}
+	for k := range c {
+		if k > 0 {
+			out, in := segment[k-1], segment[k+len(query)-1]
+			energy += in*in - out*out
+		}
+		if energy > 0 && queryEnergy > 0 {
+			c[k] = real(raw[k]) / math.Sqrt(max(energy, 0)*queryEnergy)
+		}
+	}
+
+	best := 0
+	for k := range c {
+		if c[k] > c[best] {
+			best = k
+		}
+	}
+	corr = c[best]
+	lag = float64(lo + best)
+	if best == 0 || best == len(c)-1 {
+		return lag, corr, math.Inf(1)
+	}
+
+	curvature := c[best-1] - 2*c[best] + c[best+1]
+	if curvature >= 0 {
+		return lag, corr, math.Inf(1)
+	}
+	lag += (c[best-1] - c[best+1]) / (2 * curvature)
+	noise := math.Sqrt(max(1-corr*corr, 0) / float64(len(query)))
+	return lag, corr, noise / -curvature
+}
@@ -0,0 +1,37 @@
+package signal
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAlign(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ref := make([]float64, 20000)
+	for i := range ref {
+		ref[i] = rng.NormFloat64()
+	}
+
+	query := append([]float64(nil), ref[6543:6543+4000]...)
+	lag, corr, stdErr := Align(ref, query, 6500, 100)
+	if math.Abs(lag-6543) > 1e-3 || math.Abs(corr-1) > 1e-9 || stdErr > 0.01 {
+		t.Errorf("Align = %g, %g, %g, want 6543 with a correlation of 1", lag, corr, stdErr)
+	}
+
+	// A smooth signal sampled half a sample late, with noise.
+	smooth := func(x float64) float64 {
+		return math.Sin(2*math.Pi*x/37) + 0.5*math.Sin(2*math.Pi*x/91+1)
+	}
+	for i := range ref {
+		ref[i] = smooth(float64(i))
+	}
+	query = make([]float64, 3000)
+	for i := range query {
+		query[i] = smooth(float64(i)+1000.5) + 0.1*rng.NormFloat64()
+	}
+	lag, corr, stdErr = Align(ref, query, 990, 30)
+	if math.Abs(lag-1000.5) > 0.1 || corr < 0.9 || math.IsInf(stdErr, 1) {
+		t.Errorf("Align = %g, %g, %g, want 1000.5", lag, corr, stdErr)
+	}
+}
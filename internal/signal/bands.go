@@ -0,0 +1,247 @@
+package signal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type FreqRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// BandLayout is the set of frequency bands peaks are picked in. Name is the
+// spec it was parsed from, Bands the ranges it expands to; fingerprints
+// record both so that incompatible ones are never compared.
+type BandLayout struct {
+	Name  string      `json:"name"`
+	Bands []FreqRange `json:"ranges"`
+}
+
+const (
+	defaultBandsMin = 40.0
+	defaultBandsMax = 10000.0
+)
+
+var DefaultBandLayout = BandLayout{
+	Name: "default",
+	Bands: []FreqRange{
+		{Min: 40, Max: 300},
+		{Min: 300, Max: 2000},
+		{Min: 2000, Max: 5000},
+		{Min: 5000, Max: 10000},
+	},
+}
+
+// barkEdges are the edges of the critical bands of the Bark scale, in Hz.
+var barkEdges = []float64{
+	20, 100, 200, 300, 400, 510, 630, 770, 920, 1080, 1270, 1480, 1720,
+	2000, 2320, 2700, 3150, 3700, 4400, 5300, 6400, 7700, 9500, 12000, 15500,
+}
+
+// ParseBandLayout reads a layout as given on the command line:
+//
+//	default             the four historical bands
+//	40-300,300-2000     explicit ranges in Hz
+//	log:N[:min:max]     N log-spaced bands
+//	erb:N[:min:max]     N bands evenly spaced on the ERB-rate scale
+//	bark[:min:max]      the Bark critical bands inside [min, max]
+//
+// min and max default to 40 Hz and 10 kHz.
+func ParseBandLayout(spec string) (BandLayout, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" || spec == DefaultBandLayout.Name {
+		return DefaultBandLayout, nil
+	}
+
+	name, args, _ := strings.Cut(spec, ":")
+	var bands []FreqRange
+	var err error
+	switch name {
+	case "log", "erb":
+		bands, err = scaledBands(name, args)
+	case "bark":
+		bands, err = barkBands(args)
+	default:
+		bands, err = explicitBands(spec)
+	}
+	if err != nil {
+		return BandLayout{}, fmt.Errorf("invalid band layout '%s': %w", spec, err)
+	}
+
+	return BandLayout{Name: spec, Bands: bands}, nil
+}
+
+func parseFloats(args string) ([]float64, error) {
+	if args == "" {
+		return nil, nil
+	}
+
+	var values []float64
+	for _, field := range strings.Split(args, ":") {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// bandLimits reads the optional [min, max] arguments.
+func bandLimits(values []float64) (float64, float64, error) {
+	lo, hi := defaultBandsMin, defaultBandsMax
+	switch len(values) {
+	case 0:
+	case 2:
+		lo, hi = values[0], values[1]
+	default:
+		return 0, 0, fmt.Errorf("expected both a minimum and a maximum frequency")
+	}
+
+	if lo <= 0 || hi <= lo {
+		return 0, 0, fmt.Errorf("frequency range %g-%g Hz is empty", lo, hi)
+	}
+	return lo, hi, nil
+}
+
+func scaledBands(scale, args string) ([]FreqRange, error) {
+	values, err := parseFloats(args)
+	if err != nil || len(values) == 0 {
+		return nil, fmt.Errorf("expected %s:N[:min:max]", scale)
+	}
+	n := int(values[0])
+	if float64(n) != values[0] || n < 1 {
+		return nil, fmt.Errorf("band count must be a positive integer")
+	}
+	lo, hi, err := bandLimits(values[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	toScale, fromScale := math.Log, math.Exp
+	if scale == "erb" {
+		// Glasberg and Moore's ERB-rate scale.
+		toScale = func(f float64) float64 { return 21.4 * math.Log10(1+0.00437*f) }
+		fromScale = func(e float64) float64 { return (math.Pow(10, e/21.4) - 1) / 0.00437 }
+	}
+
+	start, end := toScale(lo), toScale(hi)
+	bands := make([]FreqRange, n)
+	for i := range bands {
+		bands[i] = FreqRange{
+			Min: math.Round(fromScale(start + (end-start)*float64(i)/float64(n))),
+			Max: math.Round(fromScale(start + (end-start)*float64(i+1)/float64(n))),
+		}
+	}
+	bands[0].Min, bands[n-1].Max = lo, hi
+	return bands, nil
+}
+
+func barkBands(args string) ([]FreqRange, error) {
+	values, err := parseFloats(args)
+	if err != nil {
+		return nil, fmt.Errorf("expected bark[:min:max]")
+	}
+	lo, hi, err := bandLimits(values)
+	if err != nil {
+		return nil, err
+	}
+
+	var bands []FreqRange
+	for i := 1; i < len(barkEdges); i++ {
+		band := FreqRange{Min: max(lo, barkEdges[i-1]), Max: min(hi, barkEdges[i])}
+		if band.Max > band.Min {
+			bands = append(bands, band)
+		}
+	}
+	if len(bands) == 0 {
+		return nil, fmt.Errorf("no bark band inside %g-%g Hz", lo, hi)
+	}
+	return bands, nil
+}
+
+func explicitBands(spec string) ([]FreqRange, error) {
+	var bands []FreqRange
+	for _, field := range strings.Split(spec, ",") {
+		lo, hi, ok := strings.Cut(strings.TrimSpace(field), "-")
+		if !ok {
+			return nil, fmt.Errorf("expected ranges like 40-300,300-2000")
+		}
+		values, err := parseFloats(lo + ":" + hi)
+		if err != nil {
+			return nil, err
+		}
+		if values[0] < 0 || values[1] <= values[0] {
+			return nil, fmt.Errorf("band %s is empty", field)
+		}
+		bands = append(bands, FreqRange{Min: values[0], Max: values[1]})
+	}
+	return bands, nil
+}
+
+func (l BandLayout) String() string {
+	return l.Name
+}
+
+func (l BandLayout) MarshalText() ([]byte, error) {
+	return []byte(l.Name), nil
+}
+
+// UnmarshalText lets a layout be used directly as a flag value.
+func (l *BandLayout) UnmarshalText(text []byte) error {
+	parsed, err := ParseBandLayout(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// MarshalJSON writes the ranges along with the name, the text form is only
+// meant for flags.
+func (l BandLayout) MarshalJSON() ([]byte, error) {
+	type plain BandLayout
+	return json.Marshal(plain(l))
+}
+
+func (l *BandLayout) UnmarshalJSON(data []byte) error {
+	type plain BandLayout
+	return json.Unmarshal(data, (*plain)(l))
+}
+
+// Equal reports whether both layouts cover the same ranges, whatever spec
+// they were written with.
+func (l BandLayout) Equal(other BandLayout) bool {
+	if len(l.Bands) != len(other.Bands) {
+		return false
+	}
+	for i, band := range l.Bands {
+		if band != other.Bands[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Range is the lowest and the highest frequency of the layout.
+func (l BandLayout) Range() (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, band := range l.Bands {
+		lo, hi = min(lo, band.Min), max(hi, band.Max)
+	}
+	return lo, hi
+}
+
+// bandOf returns the index of the first band containing freq, or -1.
+func (l BandLayout) bandOf(freq float64) int {
+	for i, band := range l.Bands {
+		if freq >= band.Min && freq <= band.Max {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,82 @@
+package signal
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseBandLayout(t *testing.T) {
+	cases := []struct {
+		spec     string
+		n        int
+		min, max float64
+	}{
+		{"default", 4, 40, 10000},
+		{"", 4, 40, 10000},
+		{"100-200, 200-800", 2, 100, 800},
+		{"log:6", 6, 40, 10000},
+		{"log:3:100:8000", 3, 100, 8000},
+		{"erb:12", 12, 40, 10000},
+		{"bark", 23, 40, 10000},
+		{"bark:300:2000", 10, 300, 2000},
+	}
+
+	for _, c := range cases {
+		layout, err := ParseBandLayout(c.spec)
+		if err != nil {
+			t.Errorf("%q: %v", c.spec, err)
+			continue
+		}
+		if len(layout.Bands) != c.n {
+			t.Errorf("%q: got %d bands, want %d", c.spec, len(layout.Bands), c.n)
+		}
+		if lo, hi := layout.Range(); lo != c.min || hi != c.max {
+			t.Errorf("%q: covers %g-%g Hz, want %g-%g", c.spec, lo, hi, c.min, c.max)
+		}
+		for i := 1; i < len(layout.Bands); i++ {
+			if layout.Bands[i].Min != layout.Bands[i-1].Max {
+				t.Errorf("%q: band %d starts at %g, the previous one ends at %g", c.spec, i, layout.Bands[i].Min, layout.Bands[i-1].Max)
+			}
+		}
+	}
+
+	for _, spec := range []string{"log", "log:0", "log:2.5", "log:4:500", "erb:4:800:200", "bark:16000:20000", "300-100", "mel:10"} {
+		if _, err := ParseBandLayout(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestBandLayoutScales(t *testing.T) {
+	log, _ := ParseBandLayout("log:4:100:1600")
+	for i, band := range log.Bands {
+		if math.Abs(band.Max/band.Min-2) > 0.01 {
+			t.Errorf("log band %d is %g-%g Hz, want an octave", i, band.Min, band.Max)
+		}
+	}
+
+	// Equal bands on the ERB-rate scale get wider with frequency.
+	erb, _ := ParseBandLayout("erb:8")
+	for i := 1; i < len(erb.Bands); i++ {
+		prev, cur := erb.Bands[i-1], erb.Bands[i]
+		if cur.Max-cur.Min <= prev.Max-prev.Min {
+			t.Errorf("erb band %d (%g-%g Hz) is not wider than the previous one", i, cur.Min, cur.Max)
+		}
+	}
+
+	if !DefaultBandLayout.Equal(mustParseBandLayout(t, "40-300,300-2000,2000-5000,5000-10000")) {
+		t.Error("explicit default bands do not equal the default layout")
+	}
+	if DefaultBandLayout.Equal(log) {
+		t.Error("different layouts compare equal")
+	}
+}
+
+func mustParseBandLayout(t *testing.T, spec string) BandLayout {
+	t.Helper()
+	layout, err := ParseBandLayout(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layout
+}
@@ -0,0 +1,84 @@
+package signal
+
+import (
+	"bufio"
+	"math/bits"
+)
+
+// bitReader reads big-endian bit fields, MSB first, as used by FLAC.
+type bitReader struct {
+	r   *bufio.Reader
+	acc uint64
+	n   uint
+}
+
+func newBitReader(r *bufio.Reader) *bitReader {
+	return &bitReader{r: r}
+}
+
+func (b *bitReader) fill(need uint) error {
+	for b.n < need {
+		c, err := b.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		b.acc = b.acc<<8 | uint64(c)
+		b.n += 8
+	}
+	return nil
+}
+
+// readBits reads up to 56 bits as an unsigned value.
+func (b *bitReader) readBits(n uint) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if err := b.fill(n); err != nil {
+		return 0, err
+	}
+
+	b.n -= n
+	v := b.acc >> b.n
+	b.acc &= (1 << b.n) - 1
+	return v, nil
+}
+
+// readSigned reads an n bit two's complement value.
+func (b *bitReader) readSigned(n uint) (int64, error) {
+	v, err := b.readBits(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	shift := 64 - n
+	return int64(v<<shift) >> shift, nil
+}
+
+// readUnary counts zero bits up to and including the next one bit.
+func (b *bitReader) readUnary() (uint64, error) {
+	count := uint64(0)
+	for {
+		if b.n == 0 {
+			if err := b.fill(8); err != nil {
+				return 0, err
+			}
+		}
+		if b.acc == 0 {
+			count += uint64(b.n)
+			b.n = 0
+			continue
+		}
+
+		top := uint(bits.Len64(b.acc)) - 1
+		count += uint64(b.n - 1 - top)
+		b.n = top
+		b.acc &= (1 << b.n) - 1
+		return count, nil
+	}
+}
+
+// align drops the bits left in the current byte.
+func (b *bitReader) align() {
+	b.n -= b.n % 8
+	b.acc &= (1 << b.n) - 1
+}
@@ -0,0 +1,154 @@
+package signal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type ChannelKind int
+
+const (
+	// ChannelDownmix averages every channel into one mono signal.
+	ChannelDownmix ChannelKind = iota
+	// ChannelSingle picks one channel by index.
+	ChannelSingle
+	// ChannelMid is (L+R)/2 of the first two channels.
+	ChannelMid
+	// ChannelSide is (L-R)/2 of the first two channels, which keeps what
+	// the downmix cancels when the channels are out of phase.
+	ChannelSide
+	// ChannelAll analyzes every channel separately.
+	ChannelAll
+)
+
+// ChannelMode selects the signal, or signals, a command analyzes out of a
+// multichannel file.
+type ChannelMode struct {
+	Kind ChannelKind
+	// Channel is the zero based channel index for ChannelSingle.
+	Channel int
+}
+
+var DownmixChannels = ChannelMode{Kind: ChannelDownmix}
+
+// ParseChannelMode reads a mode as given on the command line: "mix", "mid",
+// "side", "all", "left", "right" or a zero based channel index.
+func ParseChannelMode(spec string) (ChannelMode, error) {
+	switch strings.ToLower(strings.TrimSpace(spec)) {
+	case "mix", "mono", "downmix", "":
+		return DownmixChannels, nil
+	case "mid":
+		return ChannelMode{Kind: ChannelMid}, nil
+	case "side":
+		return ChannelMode{Kind: ChannelSide}, nil
+	case "all":
+		return ChannelMode{Kind: ChannelAll}, nil
+	case "left", "l":
+		return ChannelMode{Kind: ChannelSingle, Channel: 0}, nil
+	case "right", "r":
+		return ChannelMode{Kind: ChannelSingle, Channel: 1}, nil
+	}
+
+	// String writes single channels as "ch1".
+	channel, err := strconv.Atoi(strings.TrimPrefix(spec, "ch"))
+	if err != nil || channel < 0 {
+		return ChannelMode{}, fmt.Errorf("unknown channel mode '%s', expected %s", spec, ChannelModeNames())
+	}
+	return ChannelMode{Kind: ChannelSingle, Channel: channel}, nil
+}
+
+// ChannelModeNames lists the accepted channel modes, for flag help texts.
+func ChannelModeNames() string {
+	return "mix, mid, side, all, left, right or a channel index"
+}
+
+func (m ChannelMode) String() string {
+	switch m.Kind {
+	case ChannelSingle:
+		return "ch" + strconv.Itoa(m.Channel)
+	case ChannelMid:
+		return "mid"
+	case ChannelSide:
+		return "side"
+	case ChannelAll:
+		return "all"
+	}
+	return "mix"
+}
+
+// Split expands ChannelAll into one single channel mode per channel. Any
+// other mode is returned on its own.
+func (m ChannelMode) Split(channels int) []ChannelMode {
+	if m.Kind != ChannelAll {
+		return []ChannelMode{m}
+	}
+
+	modes := make([]ChannelMode, channels)
+	for ch := range modes {
+		modes[ch] = ChannelMode{Kind: ChannelSingle, Channel: ch}
+	}
+	return modes
+}
+
+// weights returns the gain applied to each channel to build the mode's
+// signal. Every mode except ChannelAll is such a linear mix.
+func (m ChannelMode) weights(channels int) ([]float64, error) {
+	weights := make([]float64, channels)
+
+	switch m.Kind {
+	case ChannelDownmix:
+		for ch := range weights {
+			weights[ch] = 1 / float64(channels)
+		}
+	case ChannelSingle:
+		if m.Channel >= channels {
+			return nil, fmt.Errorf("channel %d out of range, the audio has %d channels", m.Channel, channels)
+		}
+		weights[m.Channel] = 1
+	case ChannelMid, ChannelSide:
+		if channels < 2 {
+			return nil, fmt.Errorf("%s needs at least two channels, the audio has %d", m, channels)
+		}
+		weights[0], weights[1] = 0.5, 0.5
+		if m.Kind == ChannelSide {
+			weights[1] = -0.5
+		}
+	default:
+		return nil, fmt.Errorf("channel mode %s yields more than one signal", m)
+	}
+
+	return weights, nil
+}
+
+// Select mixes the channels of d as mode asks. It returns one signal per
+// channel for ChannelAll and a single signal otherwise.
+func (d *AudioData) Select(mode ChannelMode) ([][]float64, error) {
+	var signals [][]float64
+	for _, m := range mode.Split(len(d.Channels)) {
+		weights, err := m.weights(len(d.Channels))
+		if err != nil {
+			return nil, err
+		}
+
+		if m.Kind == ChannelSingle {
+			signals = append(signals, d.Channels[m.Channel])
+			continue
+		}
+		signals = append(signals, mixChannels(d.Channels, weights))
+	}
+	return signals, nil
+}
+
+func mixChannels(channels [][]float64, weights []float64) []float64 {
+	out := make([]float64, len(channels[0]))
+	for ch, w := range weights {
+		if w == 0 {
+			continue
+		}
+		for i, v := range channels[ch] {
+			out[i] += w * v
+		}
+	}
+	return out
+}
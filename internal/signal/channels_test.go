@@ -0,0 +1,117 @@
+package signal
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseChannelMode(t *testing.T) {
+	cases := map[string]ChannelMode{
+		"mix":   DownmixChannels,
+		"":      DownmixChannels,
+		"mid":   {Kind: ChannelMid},
+		"side":  {Kind: ChannelSide},
+		"all":   {Kind: ChannelAll},
+		"right": {Kind: ChannelSingle, Channel: 1},
+		"3":     {Kind: ChannelSingle, Channel: 3},
+		"ch2":   {Kind: ChannelSingle, Channel: 2},
+	}
+	for spec, want := range cases {
+		got, err := ParseChannelMode(spec)
+		if err != nil || got != want {
+			t.Errorf("%q: got %v, %v, want %v", spec, got, err, want)
+		}
+	}
+
+	for _, spec := range []string{"-1", "center", "1.5"} {
+		if _, err := ParseChannelMode(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
+
+func TestSelectChannels(t *testing.T) {
+	data := &AudioData{SampleRate: 8000, Channels: [][]float64{{1, 0.5, -1}, {-1, 0.5, 0}}}
+
+	cases := []struct {
+		mode ChannelMode
+		want [][]float64
+	}{
+		{DownmixChannels, [][]float64{{0, 0.5, -0.5}}},
+		{ChannelMode{Kind: ChannelSingle, Channel: 1}, [][]float64{{-1, 0.5, 0}}},
+		{ChannelMode{Kind: ChannelMid}, [][]float64{{0, 0.5, -0.5}}},
+		{ChannelMode{Kind: ChannelSide}, [][]float64{{1, 0, -0.5}}},
+		{ChannelMode{Kind: ChannelAll}, data.Channels},
+	}
+
+	for _, c := range cases {
+		got, err := data.Select(c.mode)
+		if err != nil {
+			t.Fatalf("%s: %v", c.mode, err)
+		}
+		if len(got) != len(c.want) {
+			t.Fatalf("%s: got %d signals, want %d", c.mode, len(got), len(c.want))
+		}
+		for i := range c.want {
+			for j := range c.want[i] {
+				if got[i][j] != c.want[i][j] {
+					t.Fatalf("%s signal %d sample %d: got %f, want %f", c.mode, i, j, got[i][j], c.want[i][j])
+				}
+			}
+		}
+	}
+
+	if _, err := data.Select(ChannelMode{Kind: ChannelSingle, Channel: 2}); err == nil {
+		t.Error("selecting a missing channel succeeded")
+	}
+	mono := &AudioData{SampleRate: 8000, Channels: [][]float64{{1, 2}}}
+	if _, err := mono.Select(ChannelMode{Kind: ChannelSide}); err == nil {
+		t.Error("side of a mono signal succeeded")
+	}
+}
+
+func TestMixReaderMatchesSelect(t *testing.T) {
+	samples := [][]int16{{0, 1000, -32768, 32767, 5, 9}, {-1, 2, 3, -4, 16384, -9}}
+	path := filepath.Join(t.TempDir(), "stereo.aiff")
+	if err := os.WriteFile(path, encodeTestAIFF(samples, 8000, false), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadAudio(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenAudio(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, mode := range []ChannelMode{DownmixChannels, {Kind: ChannelSide}, {Kind: ChannelSingle, Channel: 1}} {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		mix, err := MixReader(r, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := data.Select(mode)
+
+		got := make([]float64, 16)
+		n, err := mix.ReadSamples(got)
+		if err != nil || n != len(want[0]) {
+			t.Fatalf("%s: read %d samples, %v", mode, n, err)
+		}
+		for i := range n {
+			if got[i] != want[0][i] {
+				t.Fatalf("%s sample %d: got %f, want %f", mode, i, got[i], want[0][i])
+			}
+		}
+	}
+
+	if _, err := MixReader(r, ChannelMode{Kind: ChannelAll}); err == nil {
+		t.Error("MixReader accepted ChannelAll")
+	}
+}
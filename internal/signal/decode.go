@@ -0,0 +1,217 @@
+package signal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type AudioFormat string
+
+const (
+	FormatUnknown AudioFormat = ""
+	FormatWAV     AudioFormat = "wav"
+	FormatAIFF    AudioFormat = "aiff"
+	FormatFLAC    AudioFormat = "flac"
+	FormatMP3     AudioFormat = "mp3"
+	FormatVorbis  AudioFormat = "ogg/vorbis"
+	FormatOgg     AudioFormat = "ogg"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+// SupportedExtensions lists the file extensions ReadAudio can decode, for
+// commands that scan directories.
+var SupportedExtensions = []string{".wav", ".wave", ".aif", ".aiff", ".aifc", ".flac", ".mp3", ".ogg", ".oga"}
+
+// pcmDecoder is implemented by every native decoder. Read fills each
+// channel slice of frames with up to len(frames[0]) samples and returns
+// io.EOF once the stream is exhausted. Seek follows io.Seeker but counts
+// frames rather than bytes, and Length reports the total number of frames,
+// or -1 if unknown.
+type pcmDecoder interface {
+	SampleRate() int
+	Channels() int
+	Read(frames [][]float64) (int, error)
+	io.Seeker
+	Length() int64
+}
+
+// AudioReader streams decoded audio from a file without loading it whole.
+// It is a pcmDecoder that also owns the underlying file.
+type AudioReader interface {
+	pcmDecoder
+	io.Closer
+}
+
+type fileAudioReader struct {
+	pcmDecoder
+	f *os.File
+}
+
+func (r *fileAudioReader) Close() error {
+	return r.f.Close()
+}
+
+func seekTarget(offset int64, whence int, current, length int64) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += current
+	case io.SeekEnd:
+		if length < 0 {
+			return 0, fmt.Errorf("seek relative to the end of a stream of unknown length")
+		}
+		offset += length
+	default:
+		return 0, fmt.Errorf("invalid seek whence %d", whence)
+	}
+
+	if offset < 0 || length >= 0 && offset > length {
+		return 0, fmt.Errorf("seek to frame %d outside of [0, %d]", offset, length)
+	}
+	return offset, nil
+}
+
+// SniffFormat identifies an audio container from the first bytes of a file.
+// At least 64 bytes are needed to tell Ogg codecs apart.
+func SniffFormat(header []byte) AudioFormat {
+	switch {
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return FormatWAV
+	case len(header) >= 12 && string(header[0:4]) == "FORM" && (string(header[8:12]) == "AIFF" || string(header[8:12]) == "AIFC"):
+		return FormatAIFF
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return FormatFLAC
+	case bytes.HasPrefix(header, []byte("OggS")):
+		if bytes.Contains(header, []byte("\x01vorbis")) {
+			return FormatVorbis
+		}
+		return FormatOgg
+	case bytes.HasPrefix(header, []byte("ID3")):
+		return FormatMP3
+	case len(header) >= 2 && header[0] == 0xff && header[1]&0xe0 == 0xe0 && header[1]&0x06 != 0:
+		return FormatMP3
+	}
+
+	return FormatUnknown
+}
+
+// OpenAudio opens an audio file for streaming, choosing the decoder from
+// the file contents rather than its extension. The caller must Close it.
+func OpenAudio(path string) (AudioReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := newDecoder(f, path)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileAudioReader{pcmDecoder: dec, f: f}, nil
+}
+
+func newDecoder(f *os.File, path string) (pcmDecoder, error) {
+	header := make([]byte, 64)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("reading '%s': %w", path, err)
+	}
+	header = header[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var dec pcmDecoder
+	switch format := SniffFormat(header); format {
+	case FormatWAV:
+		dec, err = newWAVReader(f)
+	case FormatAIFF:
+		dec, err = newAIFFDecoder(f)
+	case FormatFLAC:
+		dec, err = newFLACDecoder(f)
+	case FormatMP3:
+		dec, err = newMP3Decoder(f)
+	case FormatVorbis:
+		dec, err = newVorbisDecoder(f)
+	case FormatOgg:
+		return nil, fmt.Errorf("'%s' is %s: %w (only Vorbis is decoded from Ogg)", path, format, ErrUnsupportedFormat)
+	default:
+		return nil, fmt.Errorf("'%s': %w", path, ErrUnsupportedFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding '%s': %w", path, err)
+	}
+	return dec, nil
+}
+
+// ReadAudio decodes a whole audio file into memory.
+func ReadAudio(path string) (*AudioData, error) {
+	r, err := OpenAudio(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return readAllFrames(r)
+}
+
+func readAllFrames(dec pcmDecoder) (*AudioData, error) {
+	numChannels := dec.Channels()
+	channels := make([][]float64, numChannels)
+	chunk := make([][]float64, numChannels)
+	for ch := range chunk {
+		chunk[ch] = make([]float64, 8192)
+	}
+
+	for {
+		n, err := dec.Read(chunk)
+		for ch := range channels {
+			channels[ch] = append(channels[ch], chunk[ch][:n]...)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &AudioData{
+		SampleRate: dec.SampleRate(),
+		Channels:   channels,
+	}, nil
+}
+
+// IsAudioFile reports whether path has one of the SupportedExtensions.
+func IsAudioFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, supported := range SupportedExtensions {
+		if ext == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// GlobAudioFiles lists the decodable audio files directly inside dir.
+func GlobAudioFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && IsAudioFile(entry.Name()) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
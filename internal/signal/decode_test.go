@@ -0,0 +1,513 @@
+package signal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type bitWriter struct {
+	buf  bytes.Buffer
+	acc  uint64
+	bits uint
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.acc = w.acc<<1 | (v>>uint(i))&1
+		w.bits++
+		if w.bits == 8 {
+			w.buf.WriteByte(byte(w.acc))
+			w.acc, w.bits = 0, 0
+		}
+	}
+}
+
+func (w *bitWriter) writeSigned(v int64, n uint) {
+	w.write(uint64(v)&(1<<n-1), n)
+}
+
+func (w *bitWriter) writeRice(v int64, param uint) {
+	u := uint64(v<<1) ^ uint64(v>>63)
+	for range u >> param {
+		w.write(0, 1)
+	}
+	w.write(1, 1)
+	w.write(u&(1<<param-1), param)
+}
+
+func (w *bitWriter) align() {
+	for w.bits != 0 {
+		w.write(0, 1)
+	}
+}
+
+func testTone(n int, amplitude float64, freq float64) []int64 {
+	out := make([]int64, n)
+	for i := range out {
+		out[i] = int64(math.Round(amplitude * math.Sin(2*math.Pi*freq*float64(i)/44100)))
+	}
+	return out
+}
+
+// encodeTestFLAC writes a FLAC stream whose frames cycle through the
+// subframe types the decoder supports.
+func encodeTestFLAC(left, right []int64, blockSize int) []byte {
+	const bitDepth = 16
+	w := &bitWriter{}
+	w.buf.WriteString("fLaC")
+
+	w.write(1, 1)
+	w.write(0, 7)
+	w.write(34, 24)
+	w.write(uint64(blockSize), 16)
+	w.write(uint64(blockSize), 16)
+	w.write(0, 24)
+	w.write(0, 24)
+	w.write(44100, 20)
+	w.write(1, 3)
+	w.write(bitDepth-1, 5)
+	w.write(uint64(len(left)), 36)
+	w.write(0, 64)
+	w.write(0, 64)
+
+	for frame := 0; frame*blockSize < len(left); frame++ {
+		start := frame * blockSize
+		end := min(start+blockSize, len(left))
+		l, r := left[start:end], right[start:end]
+
+		channelCode := uint64([]int{1, 8, 9, 10}[frame%4])
+		w.write(0x7ffc, 15)
+		w.write(0, 1)
+		w.write(7, 4)
+		w.write(0, 4)
+		w.write(channelCode, 4)
+		w.write(0, 3)
+		w.write(0, 1)
+		w.write(uint64(frame), 8)
+		w.write(uint64(end-start-1), 16)
+		w.write(0, 8)
+
+		var first, second []int64
+		var firstDepth, secondDepth uint = bitDepth, bitDepth
+		side := make([]int64, len(l))
+		for i := range l {
+			side[i] = l[i] - r[i]
+		}
+		switch channelCode {
+		case 1:
+			first, second = l, r
+		case 8:
+			first, second, secondDepth = l, side, bitDepth+1
+		case 9:
+			first, second, firstDepth = side, r, bitDepth+1
+		case 10:
+			mid := make([]int64, len(l))
+			for i := range l {
+				mid[i] = (l[i] + r[i]) >> 1
+			}
+			first, second, secondDepth = mid, side, bitDepth+1
+		}
+
+		writeTestSubframe(w, first, firstDepth, frame%5)
+		writeTestSubframe(w, second, secondDepth, (frame+2)%5)
+
+		w.align()
+		w.write(0, 16)
+	}
+
+	return w.buf.Bytes()
+}
+
+func writeTestSubframe(w *bitWriter, samples []int64, depth uint, kind int) {
+	switch kind {
+	case 0:
+		w.write(0x01<<1, 8)
+		for _, s := range samples {
+			w.writeSigned(s, depth)
+		}
+	case 1:
+		w.write(0x0a<<1, 8)
+		w.writeSigned(samples[0], depth)
+		w.writeSigned(samples[1], depth)
+		w.write(0, 2)
+		w.write(0, 4)
+		w.write(10, 4)
+		for i := 2; i < len(samples); i++ {
+			w.writeRice(samples[i]-(2*samples[i-1]-samples[i-2]), 10)
+		}
+	case 2:
+		// LPC order 2 with coefficients 2 and -1 at precision 4, shift 0,
+		// split in two partitions of which the second is escaped.
+		w.write((32+1)<<1, 8)
+		w.writeSigned(samples[0], depth)
+		w.writeSigned(samples[1], depth)
+		w.write(3, 4)
+		w.writeSigned(0, 5)
+		w.writeSigned(2, 4)
+		w.writeSigned(-1, 4)
+		w.write(1, 2)
+		w.write(1, 4)
+		half := len(samples) / 2
+		w.write(11, 5)
+		for i := 2; i < half; i++ {
+			w.writeRice(samples[i]-(2*samples[i-1]-samples[i-2]), 11)
+		}
+		w.write(31, 5)
+		w.write(20, 5)
+		for i := half; i < len(samples); i++ {
+			w.writeSigned(samples[i]-(2*samples[i-1]-samples[i-2]), 20)
+		}
+	case 3:
+		// Verbatim with one wasted bit: every sample must be even.
+		w.write(0x01<<1|1, 8)
+		w.write(1, 1)
+		for _, s := range samples {
+			w.writeSigned(s>>1, depth-1)
+		}
+	case 4:
+		w.write(0x09<<1, 8)
+		w.writeSigned(samples[0], depth)
+		w.write(0, 2)
+		w.write(0, 4)
+		w.write(0xf, 4)
+		w.write(uint64(depth+1), 5)
+		for i := 1; i < len(samples); i++ {
+			w.writeSigned(samples[i]-samples[i-1], depth+1)
+		}
+	}
+}
+
+func TestFLACDecoder(t *testing.T) {
+	n := 4096*5 + 124
+	left := testTone(n, 12000, 440)
+	right := testTone(n, 9000, 660)
+	for i := range left {
+		// Keep both channels even so wasted-bit subframes are valid for every
+		// channel layout, including the derived side and mid channels.
+		left[i] &^= 3
+		right[i] &^= 3
+	}
+
+	path := filepath.Join(t.TempDir(), "tone.flac")
+	if err := os.WriteFile(path, encodeTestFLAC(left, right, 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadAudio(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.SampleRate != 44100 || len(data.Channels) != 2 || len(data.Channels[0]) != n {
+		t.Fatalf("got %d Hz, %d channels, %d samples", data.SampleRate, len(data.Channels), len(data.Channels[0]))
+	}
+
+	for i := range n {
+		if data.Channels[0][i] != float64(left[i])/32768 || data.Channels[1][i] != float64(right[i])/32768 {
+			t.Fatalf("sample %d: got (%f, %f), want (%f, %f)", i,
+				data.Channels[0][i], data.Channels[1][i], float64(left[i])/32768, float64(right[i])/32768)
+		}
+	}
+}
+
+func encodeTestAIFF(samples [][]int16, sampleRate int, sowt bool) []byte {
+	numFrames := len(samples[0])
+	var comm bytes.Buffer
+	binary.Write(&comm, binary.BigEndian, int16(len(samples)))
+	binary.Write(&comm, binary.BigEndian, uint32(numFrames))
+	binary.Write(&comm, binary.BigEndian, int16(16))
+
+	mant, exp := math.Frexp(float64(sampleRate))
+	binary.Write(&comm, binary.BigEndian, uint16(exp-1+16383))
+	binary.Write(&comm, binary.BigEndian, uint64(math.Ldexp(mant, 64)))
+	formType := "AIFF"
+	if sowt {
+		formType = "AIFC"
+		comm.WriteString("sowt")
+		comm.Write([]byte{0, 0})
+	}
+
+	var ssnd bytes.Buffer
+	ssnd.Write(make([]byte, 8))
+	order := binary.ByteOrder(binary.BigEndian)
+	if sowt {
+		order = binary.LittleEndian
+	}
+	for i := range numFrames {
+		for ch := range samples {
+			binary.Write(&ssnd, order, samples[ch][i])
+		}
+	}
+
+	var file bytes.Buffer
+	file.WriteString("FORM")
+	binary.Write(&file, binary.BigEndian, uint32(4+8+comm.Len()+8+ssnd.Len()))
+	file.WriteString(formType)
+	file.WriteString("COMM")
+	binary.Write(&file, binary.BigEndian, uint32(comm.Len()))
+	file.Write(comm.Bytes())
+	file.WriteString("SSND")
+	binary.Write(&file, binary.BigEndian, uint32(ssnd.Len()))
+	file.Write(ssnd.Bytes())
+	return file.Bytes()
+}
+
+func TestAIFFDecoder(t *testing.T) {
+	samples := [][]int16{{0, 1000, -32768, 32767, 5}, {-1, 2, 3, -4, 16384}}
+
+	for _, sowt := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "tone.aiff")
+		if err := os.WriteFile(path, encodeTestAIFF(samples, 48000, sowt), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ReadAudio(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.SampleRate != 48000 || len(data.Channels) != 2 {
+			t.Fatalf("got %d Hz, %d channels", data.SampleRate, len(data.Channels))
+		}
+		for ch := range samples {
+			for i, v := range samples[ch] {
+				if got := data.Channels[ch][i]; got != float64(v)/32768 {
+					t.Fatalf("sowt=%v channel %d sample %d: got %f, want %f", sowt, ch, i, got, float64(v)/32768)
+				}
+			}
+		}
+	}
+}
+
+func TestSniffFormat(t *testing.T) {
+	cases := map[string]AudioFormat{
+		"RIFF\x00\x00\x00\x00WAVEfmt ":                           FormatWAV,
+		"FORM\x00\x00\x00\x00AIFFCOMM":                           FormatAIFF,
+		"FORM\x00\x00\x00\x00AIFCFVER":                           FormatAIFF,
+		"fLaC\x00\x00\x00\x22":                                   FormatFLAC,
+		"ID3\x04\x00\x00":                                        FormatMP3,
+		"\xff\xfb\x90\x00":                                       FormatMP3,
+		"OggS\x00\x02" + string(make([]byte, 22)) + "\x01vorbis": FormatVorbis,
+		"OggS\x00\x02" + string(make([]byte, 22)) + "OpusHead":   FormatOgg,
+		"hello world":                                            FormatUnknown,
+	}
+
+	for header, want := range cases {
+		if got := SniffFormat([]byte(header)); got != want {
+			t.Errorf("%q: got %q, want %q", header, got, want)
+		}
+	}
+}
+
+func encodeTestWAV(format, bitDepth, channels int, data []byte) []byte {
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(4+8+16+8+len(data)))
+	file.WriteString("WAVE")
+	file.WriteString("fmt ")
+	binary.Write(&file, binary.LittleEndian, uint32(16))
+	binary.Write(&file, binary.LittleEndian, uint16(format))
+	binary.Write(&file, binary.LittleEndian, uint16(channels))
+	binary.Write(&file, binary.LittleEndian, uint32(22050))
+	blockAlign := channels * bitDepth / 8
+	binary.Write(&file, binary.LittleEndian, uint32(22050*blockAlign))
+	binary.Write(&file, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(&file, binary.LittleEndian, uint16(bitDepth))
+	file.WriteString("data")
+	binary.Write(&file, binary.LittleEndian, uint32(len(data)))
+	file.Write(data)
+	return file.Bytes()
+}
+
+func TestWAVReader(t *testing.T) {
+	var pcm16, pcm8, float32le bytes.Buffer
+	binary.Write(&pcm16, binary.LittleEndian, []int16{0, -1, 16384, -32768, 32767, 2})
+	pcm8.Write([]byte{128, 0, 255, 192})
+	binary.Write(&float32le, binary.LittleEndian, []float32{0.5, -0.25, 1})
+
+	cases := []struct {
+		name     string
+		file     []byte
+		channels int
+		want     []float64
+	}{
+		{"pcm16", encodeTestWAV(wavFormatPCM, 16, 2, pcm16.Bytes()), 2, []float64{0, -1.0 / 32768, 0.5, -1, 32767.0 / 32768, 2.0 / 32768}},
+		{"pcm8", encodeTestWAV(wavFormatPCM, 8, 1, pcm8.Bytes()), 1, []float64{0, -1, 127.0 / 128, 0.5}},
+		{"float32", encodeTestWAV(wavFormatFloat, 32, 1, float32le.Bytes()), 1, []float64{0.5, -0.25, 1}},
+	}
+
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), c.name+".wav")
+		if err := os.WriteFile(path, c.file, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ReadAudio(path)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if data.SampleRate != 22050 || len(data.Channels) != c.channels {
+			t.Fatalf("%s: got %d Hz, %d channels", c.name, data.SampleRate, len(data.Channels))
+		}
+		for i, want := range c.want {
+			if got := data.Channels[i%c.channels][i/c.channels]; got != want {
+				t.Fatalf("%s sample %d: got %f, want %f", c.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestAudioReaderSeek(t *testing.T) {
+	n := 4096*3 + 500
+	left := testTone(n, 12000, 440)
+	right := testTone(n, 9000, 660)
+	for i := range left {
+		left[i] &^= 3
+		right[i] &^= 3
+	}
+
+	path := filepath.Join(t.TempDir(), "tone.flac")
+	if err := os.WriteFile(path, encodeTestFLAC(left, right, 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := OpenAudio(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.Length() != int64(n) {
+		t.Fatalf("got length %d, want %d", r.Length(), n)
+	}
+
+	frames := [][]float64{make([]float64, 10), make([]float64, 10)}
+	for _, target := range []int64{5000, 17, 4096*3 + 495, 8191} {
+		pos, err := r.Seek(target, io.SeekStart)
+		if err != nil || pos != target {
+			t.Fatalf("seek to %d: got %d, %v", target, pos, err)
+		}
+		if _, err := r.Read(frames); err != nil {
+			t.Fatal(err)
+		}
+		if frames[0][0] != float64(left[target])/32768 || frames[1][4] != float64(right[target+4])/32768 {
+			t.Fatalf("seek to %d: read the wrong samples", target)
+		}
+	}
+
+	if pos, err := r.Seek(-3, io.SeekEnd); err != nil || pos != int64(n-3) {
+		t.Fatalf("seek from end: got %d, %v", pos, err)
+	}
+	if count, err := r.Read(frames); count != 3 || err != nil {
+		t.Fatalf("read at the end: got %d, %v", count, err)
+	}
+	if _, err := r.Read(frames); err != io.EOF {
+		t.Fatalf("read past the end: got %v, want io.EOF", err)
+	}
+	if _, err := r.Seek(int64(n+1), io.SeekStart); err == nil {
+		t.Fatal("seek past the end succeeded")
+	}
+}
+
+func TestWAVWriterRoundTrip(t *testing.T) {
+	n := 1001
+	channels := make([][]float64, 3)
+	for ch := range channels {
+		channels[ch] = make([]float64, n)
+		for i := range channels[ch] {
+			channels[ch][i] = math.Sin(float64(i*(ch+1))/50) * 0.9
+		}
+	}
+	// Out of range samples are clipped by integer formats.
+	channels[0][0], channels[1][0] = 1.5, -1.5
+
+	for _, format := range []SampleFormat{PCM16, PCM24, PCM32, Float32} {
+		path := filepath.Join(t.TempDir(), "out.wav")
+		data := &AudioData{SampleRate: 32000, Channels: channels}
+		if err := WriteWAV(path, data, format); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		got, err := ReadAudio(path)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if got.SampleRate != 32000 || len(got.Channels) != 3 || len(got.Channels[0]) != n {
+			t.Fatalf("%s: got %d Hz, %d channels, %d samples", format, got.SampleRate, len(got.Channels), len(got.Channels[0]))
+		}
+
+		tol := math.Ldexp(1, 1-format.BitDepth)
+		if format.Float {
+			tol = 1e-7
+		}
+		for ch := range channels {
+			for i, want := range channels[ch] {
+				if !format.Float {
+					want = max(-1, min(1-math.Ldexp(1, 1-format.BitDepth), want))
+				}
+				if math.Abs(got.Channels[ch][i]-want) > tol {
+					t.Fatalf("%s channel %d sample %d: got %f, want %f", format, ch, i, got.Channels[ch][i], want)
+				}
+			}
+		}
+	}
+}
+
+// TestCompressedDecoders decodes the short MP3 and Ogg Vorbis files in
+// testdata, whole and after seeking.
+func TestCompressedDecoders(t *testing.T) {
+	for _, name := range []string{"tone.mp3", "tone.ogg"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("testdata", name)
+			if !IsAudioFile(path) {
+				t.Fatalf("%s is not a supported extension", filepath.Ext(path))
+			}
+			data, err := ReadAudio(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data.SampleRate != 44100 {
+				t.Fatalf("got sample rate %d, want 44100", data.SampleRate)
+			}
+
+			r, err := OpenAudio(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if r.Length() != int64(len(data.Channels[0])) {
+				t.Fatalf("got length %d, decoded %d frames", r.Length(), len(data.Channels[0]))
+			}
+
+			peak := 0.0
+			for _, v := range data.Channels[0] {
+				peak = max(peak, math.Abs(v))
+			}
+			if peak == 0 || peak > 1 {
+				t.Fatalf("got peak %g, want within (0, 1]", peak)
+			}
+
+			frames := make([][]float64, r.Channels())
+			for ch := range frames {
+				frames[ch] = make([]float64, 64)
+			}
+			for _, target := range []int64{10000, 1234} {
+				if pos, err := r.Seek(target, io.SeekStart); err != nil || pos != target {
+					t.Fatalf("seek to %d: got %d, %v", target, pos, err)
+				}
+				n, err := r.Read(frames)
+				if err != nil || n != len(frames[0]) {
+					t.Fatalf("read after seeking to %d: got %d, %v", target, n, err)
+				}
+				for i, v := range frames[0] {
+					if math.Abs(v-data.Channels[0][target+int64(i)]) > 1e-6 {
+						t.Fatalf("seek to %d: frame %d is %g, want %g", target, i, v, data.Channels[0][target+int64(i)])
+					}
+				}
+			}
+		})
+	}
+}
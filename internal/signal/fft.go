@@ -1,71 +1,196 @@
 package signal
 
 import (
+	"fmt"
 	"math"
 	"math/cmplx"
+	"runtime"
+	"sync"
 )
 
-const ConcurrencyThreshold = 1024
+// Transforms larger than this are split across goroutines stage by stage.
+const ConcurrencyThreshold = 1 << 16
 
-func FFT(x []complex128) []complex128 {
-	n := len(x)
+// FFTPlan holds the precomputed tables for a transform of a fixed size, so
+// repeated transforms of that size reuse them. Powers of two use an in-place
+// radix-2 transform, sizes made of 2, 3 and 5 factors a mixed-radix one and
+// every other size Bluestein's chirp-z algorithm.
+type FFTPlan struct {
+	n        int
+	twiddles []complex128
+	bitrev   []int
+
+	factors   []int
+	bluestein *bluesteinPlan
+	scratch   sync.Pool
+}
 
-	if n <= ConcurrencyThreshold {
-		return fftSequential(x)
+var fftPlans sync.Map
+
+func NewFFTPlan(n int) *FFTPlan {
+	if n < 1 {
+		panic(fmt.Sprintf("signal: invalid FFT size %d", n))
 	}
 
-	even := make([]complex128, n/2)
-	odd := make([]complex128, n/2)
-	for i := range n / 2 {
-		even[i] = x[2*i]
-		odd[i] = x[2*i+1]
+	if n&(n-1) == 0 {
+		return newRadix2Plan(n)
+	}
+	if factors, ok := smallFactors(n); ok {
+		return newMixedRadixPlan(n, factors)
 	}
+	return newBluesteinFFTPlan(n)
+}
 
-	resultEvenChannel := make(chan []complex128)
-	go func() {
-		resultEvenChannel <- FFT(even)
-	}()
+func newRadix2Plan(n int) *FFTPlan {
+	twiddles := make([]complex128, n/2)
+	for k := range twiddles {
+		twiddles[k] = unitRoot(k, n)
+	}
 
-	resOdd := FFT(odd)
-	resEven := <-resultEvenChannel
+	bits := 0
+	for 1<<bits < n {
+		bits++
+	}
+	bitrev := make([]int, n)
+	for i := range bitrev {
+		rev := 0
+		for b := range bits {
+			if i&(1<<b) != 0 {
+				rev |= 1 << (bits - 1 - b)
+			}
+		}
+		bitrev[i] = rev
+	}
 
-	result := make([]complex128, n)
-	for k := range n / 2 {
-		rotation := -2.0 * math.Pi * float64(k) / float64(n)
-		w := cmplx.Exp(complex(0, rotation))
-		t := w * resOdd[k]
-		result[k] = resEven[k] + t
-		result[k+n/2] = resEven[k] - t
+	return &FFTPlan{n: n, twiddles: twiddles, bitrev: bitrev}
+}
+
+// unitRoot returns exp(-2*pi*i*k/n).
+func unitRoot(k, n int) complex128 {
+	sin, cos := math.Sincos(-2.0 * math.Pi * float64(k) / float64(n))
+	return complex(cos, sin)
+}
+
+// PlanFFT returns a shared plan for size n, building it on first use.
+func PlanFFT(n int) *FFTPlan {
+	if p, ok := fftPlans.Load(n); ok {
+		return p.(*FFTPlan)
 	}
+	p, _ := fftPlans.LoadOrStore(n, NewFFTPlan(n))
+	return p.(*FFTPlan)
+}
 
-	return result
+func (p *FFTPlan) Size() int {
+	return p.n
 }
 
-func fftSequential(x []complex128) []complex128 {
-	n := len(x)
+// Transform writes the FFT of src into dst. Both must have length Size();
+// dst may be src itself for an in-place transform, but must not otherwise
+// overlap it.
+func (p *FFTPlan) Transform(dst, src []complex128) {
+	n := p.n
+	if len(dst) != n || len(src) != n {
+		panic(fmt.Sprintf("signal: FFT plan of size %d used with buffers of size %d and %d", n, len(dst), len(src)))
+	}
+
+	switch {
+	case p.bluestein != nil:
+		p.bluestein.transform(dst, src)
+		return
+	case p.factors != nil:
+		p.transformMixedRadix(dst, src)
+		return
+	}
 
-	if n == 1 {
-		return x
+	if &dst[0] == &src[0] {
+		for i, j := range p.bitrev {
+			if i < j {
+				dst[i], dst[j] = dst[j], dst[i]
+			}
+		}
+	} else {
+		for i, j := range p.bitrev {
+			dst[i] = src[j]
+		}
 	}
 
-	even := make([]complex128, n/2)
-	odd := make([]complex128, n/2)
-	for i := 0; i < n/2; i++ {
-		even[i] = x[2*i]
-		odd[i] = x[2*i+1]
+	workers := runtime.NumCPU()
+	if n <= ConcurrencyThreshold || workers < 2 {
+		for size := 2; size <= n; size <<= 1 {
+			p.stage(dst, size, 0, n/2)
+		}
+		return
 	}
 
-	evenFft := fftSequential(even)
-	oddFft := fftSequential(odd)
+	chunk := (n/2 + workers - 1) / workers
+	var wg sync.WaitGroup
+	for size := 2; size <= n; size <<= 1 {
+		for lo := 0; lo < n/2; lo += chunk {
+			wg.Add(1)
+			go func(lo, hi int) {
+				defer wg.Done()
+				p.stage(dst, size, lo, hi)
+			}(lo, min(lo+chunk, n/2))
+		}
+		wg.Wait()
+	}
+}
+
+// Inverse writes the inverse FFT of src, scaled by 1/n, into dst with the
+// same aliasing rules as Transform.
+func (p *FFTPlan) Inverse(dst, src []complex128) {
+	if len(dst) != p.n || len(src) != p.n {
+		panic(fmt.Sprintf("signal: FFT plan of size %d used with buffers of size %d and %d", p.n, len(dst), len(src)))
+	}
+
+	for i, v := range src {
+		dst[i] = cmplx.Conj(v)
+	}
+	p.Transform(dst, dst)
+
+	scale := 1.0 / float64(p.n)
+	for i, v := range dst {
+		dst[i] = complex(real(v)*scale, -imag(v)*scale)
+	}
+}
+
+// stage runs butterflies lo..hi (out of n/2) of the stage that merges
+// blocks of the given size.
+func (p *FFTPlan) stage(x []complex128, size, lo, hi int) {
+	half := size / 2
+	step := p.n / size
+
+	for b := lo; b < hi; {
+		start := (b / half) * size
+		k := b % half
+		end := min(half, k+hi-b)
+		for ; k < end; k++ {
+			i := start + k
+			j := i + half
+			t := p.twiddles[k*step] * x[j]
+			x[j] = x[i] - t
+			x[i] += t
+			b++
+		}
+	}
+}
+
+func FFT(x []complex128) []complex128 {
+	result := make([]complex128, len(x))
+	if len(x) == 0 {
+		return result
+	}
+
+	PlanFFT(len(x)).Transform(result, x)
+	return result
+}
 
-	result := make([]complex128, n)
-	for k := 0; k < n/2; k++ {
-		rotation := -2.0 * math.Pi * float64(k) / float64(n)
-		w := cmplx.Exp(complex(0, rotation))
-		t := w * oddFft[k]
-		result[k] = evenFft[k] + t
-		result[k+n/2] = evenFft[k] - t
+func IFFT(x []complex128) []complex128 {
+	result := make([]complex128, len(x))
+	if len(x) == 0 {
+		return result
 	}
 
+	PlanFFT(len(x)).Inverse(result, x)
 	return result
 }
@@ -0,0 +1,67 @@
+package signal
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+)
+
+// bluesteinPlan evaluates a DFT of any size n as a circular convolution with
+// a chirp, computed by a power-of-two FFT of at least 2n-1 points.
+type bluesteinPlan struct {
+	n       int
+	chirp   []complex128
+	kernel  []complex128
+	conv    *FFTPlan
+	scratch sync.Pool
+}
+
+func newBluesteinFFTPlan(n int) *FFTPlan {
+	m := nextPowerOfTwo(2*n - 1)
+
+	chirp := make([]complex128, n)
+	for k := range chirp {
+		// k*k mod 2n keeps the angle small enough to stay exact for large n.
+		sq := (k * k) % (2 * n)
+		sin, cos := math.Sincos(-math.Pi * float64(sq) / float64(n))
+		chirp[k] = complex(cos, sin)
+	}
+
+	conv := PlanFFT(m)
+	kernel := make([]complex128, m)
+	kernel[0] = cmplx.Conj(chirp[0])
+	for k := 1; k < n; k++ {
+		kernel[k] = cmplx.Conj(chirp[k])
+		kernel[m-k] = kernel[k]
+	}
+	conv.Transform(kernel, kernel)
+
+	b := &bluesteinPlan{n: n, chirp: chirp, kernel: kernel, conv: conv}
+	b.scratch.New = func() any {
+		buf := make([]complex128, m)
+		return &buf
+	}
+
+	return &FFTPlan{n: n, bluestein: b}
+}
+
+func (b *bluesteinPlan) transform(dst, src []complex128) {
+	bufPtr := b.scratch.Get().(*[]complex128)
+	defer b.scratch.Put(bufPtr)
+	buf := *bufPtr
+
+	for k, w := range b.chirp {
+		buf[k] = src[k] * w
+	}
+	clear(buf[b.n:])
+
+	b.conv.Transform(buf, buf)
+	for i, v := range b.kernel {
+		buf[i] *= v
+	}
+	b.conv.Inverse(buf, buf)
+
+	for k, w := range b.chirp {
+		dst[k] = buf[k] * w
+	}
+}
@@ -0,0 +1,73 @@
+package signal
+
+// smallFactors splits n into factors of 2, 3 and 5. It reports false when n
+// has any other prime factor.
+func smallFactors(n int) ([]int, bool) {
+	var factors []int
+	for _, r := range []int{5, 3, 2} {
+		for n%r == 0 {
+			factors = append(factors, r)
+			n /= r
+		}
+	}
+
+	return factors, n == 1
+}
+
+func newMixedRadixPlan(n int, factors []int) *FFTPlan {
+	twiddles := make([]complex128, n)
+	for k := range twiddles {
+		twiddles[k] = unitRoot(k, n)
+	}
+
+	p := &FFTPlan{n: n, twiddles: twiddles, factors: factors}
+	p.scratch.New = func() any {
+		buf := make([]complex128, n)
+		return &buf
+	}
+
+	return p
+}
+
+func (p *FFTPlan) transformMixedRadix(dst, src []complex128) {
+	if &dst[0] == &src[0] {
+		buf := p.scratch.Get().(*[]complex128)
+		defer p.scratch.Put(buf)
+		copy(*buf, src)
+		src = *buf
+	}
+
+	p.mixedRadix(dst, src, 1, p.factors)
+}
+
+// mixedRadix writes the DFT of in[0], in[stride], in[2*stride]... into out
+// by splitting it into factors[0] interleaved sub-transforms and combining
+// them with one butterfly of that radix per output bin.
+func (p *FFTPlan) mixedRadix(out, in []complex128, stride int, factors []int) {
+	n := len(out)
+	if n == 1 {
+		out[0] = in[0]
+		return
+	}
+
+	r := factors[0]
+	m := n / r
+	for q := range r {
+		p.mixedRadix(out[q*m:(q+1)*m], in[q*stride:], stride*r, factors[1:])
+	}
+
+	twStride := p.n / n
+	var rotated [5]complex128
+	for k := range m {
+		for q := range r {
+			rotated[q] = out[q*m+k] * p.twiddles[q*k*twStride]
+		}
+		for s := range r {
+			var sum complex128
+			for q := range r {
+				sum += rotated[q] * p.twiddles[(q*s*m%n)*twStride]
+			}
+			out[s*m+k] = sum
+		}
+	}
+}
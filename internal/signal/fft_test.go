@@ -1,6 +1,8 @@
 package signal
 
 import (
+	"math"
+	"math/cmplx"
 	"math/rand"
 	"testing"
 )
@@ -13,6 +15,122 @@ func generateRandomData(n int) []complex128 {
 	return data
 }
 
+func naiveDFT(x []complex128) []complex128 {
+	n := len(x)
+	out := make([]complex128, n)
+	for k := range n {
+		var sum complex128
+		for t := range n {
+			angle := -2.0 * math.Pi * float64(k*t) / float64(n)
+			sum += x[t] * cmplx.Exp(complex(0, angle))
+		}
+		out[k] = sum
+	}
+	return out
+}
+
+func assertSpectraClose(t *testing.T, got, want []complex128, tol float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("length mismatch: got %d, want %d", len(got), len(want))
+	}
+	for k := range want {
+		if cmplx.Abs(got[k]-want[k]) > tol {
+			t.Fatalf("bin %d: got %v, want %v", k, got[k], want[k])
+		}
+	}
+}
+
+func TestFFTMatchesDFT(t *testing.T) {
+	for _, n := range []int{1, 2, 4, 8, 64, 1024} {
+		input := generateRandomData(n)
+		assertSpectraClose(t, FFT(input), naiveDFT(input), 1e-9*float64(n))
+	}
+}
+
+func TestFFTMixedRadixMatchesDFT(t *testing.T) {
+	for _, n := range []int{3, 5, 6, 12, 15, 30, 45, 100, 375, 3000} {
+		input := generateRandomData(n)
+		assertSpectraClose(t, FFT(input), naiveDFT(input), 1e-9*float64(n))
+	}
+}
+
+func TestFFTBluesteinMatchesDFT(t *testing.T) {
+	for _, n := range []int{7, 11, 13, 14, 97, 1021, 2205} {
+		input := generateRandomData(n)
+		assertSpectraClose(t, FFT(input), naiveDFT(input), 1e-9*float64(n))
+	}
+}
+
+func TestFFTPlanInPlace(t *testing.T) {
+	for _, n := range []int{256, 360, 257} {
+		input := generateRandomData(n)
+		want := naiveDFT(input)
+
+		buf := append([]complex128(nil), input...)
+		PlanFFT(len(buf)).Transform(buf, buf)
+		assertSpectraClose(t, buf, want, 1e-7)
+	}
+}
+
+func TestFFTPlanConcurrentStages(t *testing.T) {
+	n := ConcurrencyThreshold * 2
+	input := generateRandomData(n)
+
+	got := FFT(input)
+
+	// Compare a handful of bins against the direct sum instead of the full DFT.
+	for _, k := range []int{0, 1, 17, n / 2, n - 1} {
+		var want complex128
+		for i, v := range input {
+			angle := -2.0 * math.Pi * float64(k) * float64(i) / float64(n)
+			want += v * cmplx.Exp(complex(0, angle))
+		}
+		if cmplx.Abs(got[k]-want) > 1e-6 {
+			t.Fatalf("bin %d: got %v, want %v", k, got[k], want)
+		}
+	}
+}
+
+func TestRFFTMatchesFFT(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 16, 17, 2048, 3000} {
+		samples := make([]float64, n)
+		full := make([]complex128, n)
+		for i := range samples {
+			samples[i] = rand.Float64()*2 - 1
+			full[i] = complex(samples[i], 0)
+		}
+
+		want := naiveDFT(full)[:n/2+1]
+		assertSpectraClose(t, RFFT(samples), want, 1e-9*float64(n))
+	}
+}
+
+func TestComputeRealMagnitudesAmplitude(t *testing.T) {
+	n := 1024
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = 0.25 + 0.5*math.Cos(2*math.Pi*64*float64(i)/float64(n))
+	}
+
+	mags := ComputeRealMagnitudes(RFFT(samples), n)
+	if math.Abs(mags[0]-0.25) > 1e-9 || math.Abs(mags[64]-0.5) > 1e-9 {
+		t.Fatalf("unexpected amplitudes: dc=%f bin64=%f", mags[0], mags[64])
+	}
+}
+
+func TestRealTransformsOfNothing(t *testing.T) {
+	if got := RFFT(nil); len(got) != 0 {
+		t.Errorf("RFFT of no samples returned %d bins", len(got))
+	}
+	if got := IRFFT(nil, 0); len(got) != 0 {
+		t.Errorf("IRFFT of no samples returned %d samples", len(got))
+	}
+	if got := ComputeRealMagnitudes(nil, 0); len(got) != 0 {
+		t.Errorf("ComputeRealMagnitudes of no samples returned %d magnitudes", len(got))
+	}
+}
+
 func BenchmarkFFT_4096(b *testing.B) {
 	input := generateRandomData(4096)
 	b.ResetTimer()
@@ -22,12 +140,28 @@ func BenchmarkFFT_4096(b *testing.B) {
 	}
 }
 
-func BenchmarkFFTSequiential_4096(b *testing.B) {
+func BenchmarkFFTPlan_4096(b *testing.B) {
 	input := generateRandomData(4096)
+	output := make([]complex128, len(input))
+	plan := PlanFFT(len(input))
+	b.ResetTimer()
+
+	for b.Loop() {
+		plan.Transform(output, input)
+	}
+}
+
+func BenchmarkRFFT_4096(b *testing.B) {
+	input := make([]float64, 4096)
+	for i := range input {
+		input[i] = rand.Float64()
+	}
+	output := make([]complex128, 4096/2+1)
+	plan := PlanRealFFT(len(input))
 	b.ResetTimer()
 
 	for b.Loop() {
-		fftSequential(input)
+		plan.Transform(output, input)
 	}
 }
 
@@ -40,11 +174,13 @@ func BenchmarkFFT_1048576(b *testing.B) {
 	}
 }
 
-func BenchmarkFFTSequential_1048576(b *testing.B) {
+func BenchmarkFFTPlan_1048576(b *testing.B) {
 	input := generateRandomData(1048576)
+	output := make([]complex128, len(input))
+	plan := PlanFFT(len(input))
 	b.ResetTimer()
 
 	for b.Loop() {
-		fftSequential(input)
+		plan.Transform(output, input)
 	}
 }
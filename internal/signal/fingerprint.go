@@ -1,34 +1,24 @@
 package signal
 
 import (
-	"log"
 	"math"
 )
 
-type FreqRange struct {
-	Min float64
-	Max float64
-}
-
 type KeyPoint struct {
 	TimeSec float64 `json:"t"`
 	FreqHz  float64 `json:"f"`
 	MagDB   float64 `json:"m"`
+	// Channel is the channel the point was found in when every channel is
+	// analyzed on its own, 0 otherwise. Points only pair within a channel.
+	Channel int `json:"c,omitempty"`
 }
 
-var Bands = []FreqRange{
-	{Min: 40, Max: 300},
-	{Min: 300, Max: 2000},
-	{Min: 2000, Max: 5000},
-	{Min: 5000, Max: 10000},
-}
-
-func GetFingerprintPoints(magnitudes []float64, sampleRate int, windowSize int, currentTime float64) []KeyPoint {
+func GetFingerprintPoints(magnitudes []float64, bands []FreqRange, sampleRate int, windowSize int, currentTime float64) []KeyPoint {
 	var points []KeyPoint
 
 	silence := -70.0
 
-	for _, band := range Bands {
+	for _, band := range bands {
 		maxMag := -999.0
 		maxIdx := -1
 
@@ -58,28 +48,15 @@ func GetFingerprintPoints(magnitudes []float64, sampleRate int, windowSize int,
 	return points
 }
 
-func GetKeypointsFromFile(path string, windowSize int) []KeyPoint {
-	data, err := ReadWavToFloats(path)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	samples := data.Channels[0]
-
-	var fragmentPoints []KeyPoint
-	hopSize := windowSize / 2
-	for i := 0; i < len(samples)-windowSize; i += hopSize {
-		chunk := samples[i : i+windowSize]
-		windowed := ApplyHanningWindow(chunk)
-		padded := PadDataToPowerOfTwo(windowed)
-		fftRes := FFT(padded)
-		mags := ComputeMagnitudes(fftRes)
-
-		currentTime := float64(i) / float64(data.SampleRate)
-
-		peaks := GetFingerprintPoints(mags, data.SampleRate, windowSize, currentTime)
-		fragmentPoints = append(fragmentPoints, peaks...)
+// GetKeypointsFromReader runs extractor over a signal streamed from r.
+func GetKeypointsFromReader(stft *STFT, r SampleReader, sampleRate int, extractor PeakExtractor) ([]KeyPoint, error) {
+	var points []KeyPoint
+	for frame, err := range stft.Stream(r, sampleRate) {
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, extractor.Add(frame)...)
 	}
 
-	return fragmentPoints
+	return append(points, extractor.Flush()...), nil
 }
@@ -0,0 +1,541 @@
+package signal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type flacStreamInfo struct {
+	sampleRate   int
+	channels     int
+	bitDepth     int
+	totalSamples int64
+}
+
+// flacDecoder decodes a native FLAC stream one frame at a time. Seeking
+// decodes forward from the first frame, so it is linear in the target
+// position.
+type flacDecoder struct {
+	rs          io.ReadSeeker
+	buf         *bufio.Reader
+	br          *bitReader
+	info        flacStreamInfo
+	firstFrame  int64
+	block       [][]int64
+	pos         int
+	blockOffset int64
+}
+
+func newFLACDecoder(rs io.ReadSeeker) (*flacDecoder, error) {
+	buf := bufio.NewReaderSize(rs, 64*1024)
+
+	var marker [4]byte
+	if _, err := io.ReadFull(buf, marker[:]); err != nil {
+		return nil, err
+	}
+	if string(marker[:]) != "fLaC" {
+		return nil, fmt.Errorf("invalid flac file")
+	}
+
+	d := &flacDecoder{rs: rs, buf: buf, br: newBitReader(buf)}
+	if err := d.readMetadata(buf); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *flacDecoder) readMetadata(r *bufio.Reader) error {
+	foundInfo := false
+	d.firstFrame = 4
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return fmt.Errorf("reading flac metadata: %w", err)
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("reading flac metadata: %w", err)
+		}
+		d.firstFrame += 4 + int64(length)
+
+		if blockType == 0 {
+			if length < 34 {
+				return fmt.Errorf("flac STREAMINFO block too short")
+			}
+			packed := binary.BigEndian.Uint64(body[10:18])
+			d.info = flacStreamInfo{
+				sampleRate:   int(packed >> 44),
+				channels:     int(packed>>41&0x7) + 1,
+				bitDepth:     int(packed>>36&0x1f) + 1,
+				totalSamples: int64(packed & 0xfffffffff),
+			}
+			foundInfo = true
+		}
+
+		if last {
+			break
+		}
+	}
+
+	if !foundInfo {
+		return fmt.Errorf("flac stream has no STREAMINFO block")
+	}
+	return nil
+}
+
+func (d *flacDecoder) SampleRate() int {
+	return d.info.sampleRate
+}
+
+func (d *flacDecoder) Channels() int {
+	return d.info.channels
+}
+
+// Length is the number of frames announced by STREAMINFO, or -1 when the
+// encoder did not know it.
+func (d *flacDecoder) Length() int64 {
+	if d.info.totalSamples == 0 {
+		return -1
+	}
+	return d.info.totalSamples
+}
+
+func (d *flacDecoder) Seek(offset int64, whence int) (int64, error) {
+	frame, err := seekTarget(offset, whence, d.position(), d.Length())
+	if err != nil {
+		return 0, err
+	}
+	return frame, d.seekFrame(frame)
+}
+
+func (d *flacDecoder) position() int64 {
+	if d.block == nil {
+		return d.blockOffset
+	}
+	return d.blockOffset + int64(d.pos)
+}
+
+func (d *flacDecoder) seekFrame(frame int64) error {
+	if _, err := d.rs.Seek(d.firstFrame, io.SeekStart); err != nil {
+		return err
+	}
+	d.buf.Reset(d.rs)
+	d.br = newBitReader(d.buf)
+	d.block, d.pos, d.blockOffset = nil, 0, 0
+
+	for {
+		block, err := d.readFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if frame == d.blockOffset {
+					return nil
+				}
+				return fmt.Errorf("seek to frame %d past the end of the stream", frame)
+			}
+			return err
+		}
+
+		if d.blockOffset+int64(len(block[0])) > frame {
+			d.block = block
+			d.pos = int(frame - d.blockOffset)
+			return nil
+		}
+		d.blockOffset += int64(len(block[0]))
+	}
+}
+
+func (d *flacDecoder) Read(frames [][]float64) (int, error) {
+	want := len(frames[0])
+	scale := float64(int64(1) << (d.info.bitDepth - 1))
+
+	n := 0
+	for n < want {
+		if d.block == nil || d.pos >= len(d.block[0]) {
+			block, err := d.readFrame()
+			if err != nil {
+				if n > 0 && errors.Is(err, io.EOF) {
+					return n, nil
+				}
+				return n, err
+			}
+			if d.block != nil {
+				d.blockOffset += int64(len(d.block[0]))
+			}
+			d.block = block
+			d.pos = 0
+		}
+
+		count := min(want-n, len(d.block[0])-d.pos)
+		for ch := range frames {
+			src := d.block[ch][d.pos : d.pos+count]
+			dst := frames[ch][n : n+count]
+			for i, v := range src {
+				dst[i] = float64(v) / scale
+			}
+		}
+		d.pos += count
+		n += count
+	}
+
+	return n, nil
+}
+
+var flacSampleRates = [...]int{0, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000}
+var flacBitDepths = [...]int{0, 8, 12, 0, 16, 20, 24, 32}
+
+func (d *flacDecoder) readFrame() ([][]int64, error) {
+	br := d.br
+
+	sync, err := br.readBits(15)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	if sync != 0x7ffc {
+		return nil, fmt.Errorf("flac frame sync code not found")
+	}
+
+	// Blocking strategy bit, then the block size, sample rate, channel and
+	// bit depth codes.
+	header, err := br.readBits(17)
+	if err != nil {
+		return nil, err
+	}
+	blockSizeCode := header >> 12 & 0xf
+	sampleRateCode := header >> 8 & 0xf
+	channelCode := int(header >> 4 & 0xf)
+	bitDepthCode := header >> 1 & 0x7
+
+	if err := d.skipUTF8Number(); err != nil {
+		return nil, err
+	}
+
+	var blockSize int
+	switch {
+	case blockSizeCode == 1:
+		blockSize = 192
+	case blockSizeCode >= 2 && blockSizeCode <= 5:
+		blockSize = 576 << (blockSizeCode - 2)
+	case blockSizeCode == 6:
+		v, err := br.readBits(8)
+		if err != nil {
+			return nil, err
+		}
+		blockSize = int(v) + 1
+	case blockSizeCode == 7:
+		v, err := br.readBits(16)
+		if err != nil {
+			return nil, err
+		}
+		blockSize = int(v) + 1
+	case blockSizeCode >= 8:
+		blockSize = 256 << (blockSizeCode - 8)
+	default:
+		return nil, fmt.Errorf("reserved flac block size code")
+	}
+
+	switch sampleRateCode {
+	case 12:
+		_, err = br.readBits(8)
+	case 13, 14:
+		_, err = br.readBits(16)
+	case 15:
+		err = fmt.Errorf("invalid flac sample rate code")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bitDepth := d.info.bitDepth
+	if bitDepthCode != 0 {
+		bitDepth = flacBitDepths[bitDepthCode]
+		if bitDepth == 0 {
+			return nil, fmt.Errorf("reserved flac bit depth code")
+		}
+	}
+
+	// Header CRC-8.
+	if _, err := br.readBits(8); err != nil {
+		return nil, err
+	}
+
+	numChannels := channelCode + 1
+	if channelCode >= 8 {
+		if channelCode > 10 {
+			return nil, fmt.Errorf("reserved flac channel assignment %d", channelCode)
+		}
+		numChannels = 2
+	}
+
+	block := make([][]int64, numChannels)
+	for ch := range block {
+		depth := bitDepth
+		if (channelCode == 8 || channelCode == 10) && ch == 1 || channelCode == 9 && ch == 0 {
+			depth++
+		}
+		block[ch] = make([]int64, blockSize)
+		if err := d.readSubframe(block[ch], uint(depth)); err != nil {
+			return nil, err
+		}
+	}
+
+	switch channelCode {
+	case 8:
+		for i, side := range block[1] {
+			block[1][i] = block[0][i] - side
+		}
+	case 9:
+		for i, side := range block[0] {
+			block[0][i] = side + block[1][i]
+		}
+	case 10:
+		for i, mid := range block[0] {
+			side := block[1][i]
+			mid = mid<<1 | side&1
+			block[0][i] = (mid + side) >> 1
+			block[1][i] = (mid - side) >> 1
+		}
+	}
+
+	// Footer CRC-16.
+	br.align()
+	if _, err := br.readBits(16); err != nil {
+		return nil, err
+	}
+
+	if numChannels != d.info.channels {
+		return nil, fmt.Errorf("flac frame has %d channels, stream has %d", numChannels, d.info.channels)
+	}
+	return block, nil
+}
+
+func (d *flacDecoder) skipUTF8Number() error {
+	first, err := d.br.readBits(8)
+	if err != nil {
+		return err
+	}
+
+	extra := 0
+	for mask := uint64(0x80); first&mask != 0 && mask > 1; mask >>= 1 {
+		extra++
+	}
+	if extra == 1 || extra > 7 {
+		return fmt.Errorf("invalid flac frame number")
+	}
+	if extra > 0 {
+		_, err = d.br.readBits(uint(8 * (extra - 1)))
+	}
+	return err
+}
+
+func (d *flacDecoder) readSubframe(out []int64, bitDepth uint) error {
+	br := d.br
+
+	header, err := br.readBits(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return fmt.Errorf("invalid flac subframe padding")
+	}
+	kind := header >> 1 & 0x3f
+
+	wasted := uint(0)
+	if header&1 != 0 {
+		k, err := br.readUnary()
+		if err != nil {
+			return err
+		}
+		wasted = uint(k) + 1
+		bitDepth -= wasted
+	}
+
+	switch {
+	case kind == 0:
+		v, err := br.readSigned(bitDepth)
+		if err != nil {
+			return err
+		}
+		for i := range out {
+			out[i] = v
+		}
+	case kind == 1:
+		for i := range out {
+			if out[i], err = br.readSigned(bitDepth); err != nil {
+				return err
+			}
+		}
+	case kind >= 8 && kind <= 12:
+		if err := d.readFixed(out, int(kind-8), bitDepth); err != nil {
+			return err
+		}
+	case kind >= 32:
+		if err := d.readLPC(out, int(kind-31), bitDepth); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("reserved flac subframe type %d", kind)
+	}
+
+	if wasted > 0 {
+		for i := range out {
+			out[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+func (d *flacDecoder) readWarmup(out []int64, order int, bitDepth uint) error {
+	if order > len(out) {
+		return fmt.Errorf("flac predictor order %d exceeds block size %d", order, len(out))
+	}
+	for i := range order {
+		v, err := d.br.readSigned(bitDepth)
+		if err != nil {
+			return err
+		}
+		out[i] = v
+	}
+	return nil
+}
+
+func (d *flacDecoder) readFixed(out []int64, order int, bitDepth uint) error {
+	if err := d.readWarmup(out, order, bitDepth); err != nil {
+		return err
+	}
+	if err := d.readResidual(out, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(out); i++ {
+		switch order {
+		case 1:
+			out[i] += out[i-1]
+		case 2:
+			out[i] += 2*out[i-1] - out[i-2]
+		case 3:
+			out[i] += 3*out[i-1] - 3*out[i-2] + out[i-3]
+		case 4:
+			out[i] += 4*out[i-1] - 6*out[i-2] + 4*out[i-3] - out[i-4]
+		}
+	}
+	return nil
+}
+
+func (d *flacDecoder) readLPC(out []int64, order int, bitDepth uint) error {
+	br := d.br
+	if err := d.readWarmup(out, order, bitDepth); err != nil {
+		return err
+	}
+
+	precision, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	if precision == 15 {
+		return fmt.Errorf("invalid flac LPC precision")
+	}
+	shift, err := br.readSigned(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return fmt.Errorf("negative flac LPC shift")
+	}
+
+	coeffs := make([]int64, order)
+	for j := range coeffs {
+		if coeffs[j], err = br.readSigned(uint(precision) + 1); err != nil {
+			return err
+		}
+	}
+
+	if err := d.readResidual(out, order); err != nil {
+		return err
+	}
+
+	for i := order; i < len(out); i++ {
+		var sum int64
+		for j, c := range coeffs {
+			sum += c * out[i-1-j]
+		}
+		out[i] += sum >> uint(shift)
+	}
+	return nil
+}
+
+// readResidual stores the Rice coded residual of samples order..len(out)-1.
+func (d *flacDecoder) readResidual(out []int64, order int) error {
+	br := d.br
+
+	method, err := br.readBits(2)
+	if err != nil {
+		return err
+	}
+	paramBits, escape := uint(4), uint64(15)
+	switch method {
+	case 0:
+	case 1:
+		paramBits, escape = 5, 31
+	default:
+		return fmt.Errorf("reserved flac residual coding method")
+	}
+
+	partitionOrder, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	partitionSize := len(out) >> partitionOrder
+	if partitionSize*partitions != len(out) || partitionSize < order {
+		return fmt.Errorf("invalid flac partition order %d for block of %d", partitionOrder, len(out))
+	}
+
+	i := order
+	for p := range partitions {
+		end := (p + 1) * partitionSize
+
+		param, err := br.readBits(paramBits)
+		if err != nil {
+			return err
+		}
+
+		if param == escape {
+			rawBits, err := br.readBits(5)
+			if err != nil {
+				return err
+			}
+			for ; i < end; i++ {
+				if out[i], err = br.readSigned(uint(rawBits)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		for ; i < end; i++ {
+			q, err := br.readUnary()
+			if err != nil {
+				return err
+			}
+			r, err := br.readBits(uint(param))
+			if err != nil {
+				return err
+			}
+			v := q<<param | r
+			out[i] = int64(v>>1) ^ -int64(v&1)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package signal
+
+import (
+	"math"
+	"sort"
+)
+
+// Landmark is a pair of spectral peaks hashed into a single key, stored at
+// the time of the first (anchor) peak.
+type Landmark struct {
+	Hash    uint32  `json:"h"`
+	TimeSec float64 `json:"t"`
+}
+
+// Pairing describes how anchors are paired with the peaks that follow them
+// and how the pairs are quantized before hashing.
+type Pairing struct {
+	// FreqStep and TimeStep are the STFT bin width in Hz and hop in seconds;
+	// frequencies and time deltas are hashed in those units.
+	FreqStep float64
+	TimeStep float64
+	// FanOut is the number of targets paired with every anchor.
+	FanOut int
+	// The target zone spans MinDelta to MaxDelta frames after the anchor and
+	// MaxFreqDelta bins above or below it.
+	MinDelta     int
+	MaxDelta     int
+	MaxFreqDelta int
+}
+
+const (
+	hashFreqBits  = 10
+	hashDeltaBits = 12
+)
+
+// HashScheme names the layout of the hashes HashPair builds, fingerprints
+// record it so that a change of layout is not mistaken for a mismatch.
+const HashScheme = "pair-f10-f10-dt12"
+
+// NewPairing returns the default target zone for key points produced by
+// stft at sampleRate.
+func NewPairing(stft *STFT, sampleRate int) Pairing {
+	return Pairing{
+		FreqStep:     float64(sampleRate) / float64(stft.TransformSize()),
+		TimeStep:     float64(stft.HopSize) / float64(sampleRate),
+		FanOut:       5,
+		MinDelta:     1,
+		MaxDelta:     64,
+		MaxFreqDelta: 256,
+	}
+}
+
+// HashPair packs the anchor bin, the target bin and their distance in frames
+// into 32 bits. Values too large for their field wrap around, which only
+// adds collisions.
+func HashPair(anchorBin, targetBin, delta int) uint32 {
+	const freqMask = 1<<hashFreqBits - 1
+	const deltaMask = 1<<hashDeltaBits - 1
+	return uint32(anchorBin&freqMask)<<(hashFreqBits+hashDeltaBits) |
+		uint32(targetBin&freqMask)<<hashDeltaBits |
+		uint32(delta&deltaMask)
+}
+
+// SplitHash undoes HashPair, up to the wrap around of its fields.
+func SplitHash(h uint32) (anchorBin, targetBin, delta int) {
+	return int(h >> (hashFreqBits + hashDeltaBits)), int(h >> hashDeltaBits & (1<<hashFreqBits - 1)), int(h & (1<<hashDeltaBits - 1))
+}
+
+// GetLandmarks pairs every key point with up to FanOut of the peaks of its
+// channel in its target zone, nearest in time first.
+func GetLandmarks(points []KeyPoint, p Pairing) []Landmark {
+	type peak struct {
+		frame, bin int
+		time       float64
+		channel    int
+	}
+
+	peaks := make([]peak, len(points))
+	for i, point := range points {
+		peaks[i] = peak{
+			frame:   int(math.Round(point.TimeSec / p.TimeStep)),
+			bin:     int(math.Round(point.FreqHz / p.FreqStep)),
+			time:    point.TimeSec,
+			channel: point.Channel,
+		}
+	}
+	sort.SliceStable(peaks, func(i, j int) bool {
+		if peaks[i].frame != peaks[j].frame {
+			return peaks[i].frame < peaks[j].frame
+		}
+		return peaks[i].bin < peaks[j].bin
+	})
+
+	var landmarks []Landmark
+	for i, anchor := range peaks {
+		paired := 0
+		for _, target := range peaks[i+1:] {
+			delta := target.frame - anchor.frame
+			if delta > p.MaxDelta || paired == p.FanOut {
+				break
+			}
+			if delta < p.MinDelta || abs(target.bin-anchor.bin) > p.MaxFreqDelta || target.channel != anchor.channel {
+				continue
+			}
+
+			landmarks = append(landmarks, Landmark{
+				Hash:    HashPair(anchor.bin, target.bin, delta),
+				TimeSec: anchor.time,
+			})
+			paired++
+		}
+	}
+
+	return landmarks
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,96 @@
+package signal
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestHashPairFields(t *testing.T) {
+	h := HashPair(465, 12, 63)
+	if h>>22 != 465 || h>>12&0x3ff != 12 || h&0xfff != 63 {
+		t.Fatalf("got %032b", h)
+	}
+	if a, b, d := SplitHash(h); a != 465 || b != 12 || d != 63 {
+		t.Fatalf("split into %d, %d, %d", a, b, d)
+	}
+	if HashPair(1, 2, 3) == HashPair(2, 1, 3) {
+		t.Fatal("anchor and target are interchangeable")
+	}
+}
+
+func TestLandmarksShiftWithTheSignal(t *testing.T) {
+	pairing := NewPairing(NewSTFT(2048, 1024), 44100)
+
+	var points []KeyPoint
+	for frame := range 200 {
+		for range 1 + rand.Intn(3) {
+			points = append(points, KeyPoint{
+				TimeSec: float64(frame) * pairing.TimeStep,
+				FreqHz:  float64(10+rand.Intn(400)) * pairing.FreqStep,
+			})
+		}
+	}
+
+	// The same peaks 37 frames later, as a fragment cut out of a longer
+	// recording would see them.
+	shifted := make([]KeyPoint, len(points))
+	for i, p := range points {
+		shifted[i] = KeyPoint{TimeSec: p.TimeSec + 37*pairing.TimeStep, FreqHz: p.FreqHz}
+	}
+
+	original := GetLandmarks(points, pairing)
+	moved := GetLandmarks(shifted, pairing)
+	if len(original) == 0 || len(original) != len(moved) {
+		t.Fatalf("got %d and %d landmarks", len(original), len(moved))
+	}
+	for i := range original {
+		if original[i].Hash != moved[i].Hash {
+			t.Fatalf("landmark %d: hash %x became %x", i, original[i].Hash, moved[i].Hash)
+		}
+		if d := moved[i].TimeSec - original[i].TimeSec; d < 37*pairing.TimeStep-1e-9 || d > 37*pairing.TimeStep+1e-9 {
+			t.Fatalf("landmark %d moved by %fs", i, d)
+		}
+	}
+
+	counts := make(map[float64]int)
+	for _, l := range original {
+		counts[l.TimeSec]++
+	}
+	for anchor, n := range counts {
+		if n > pairing.FanOut*3 {
+			t.Fatalf("anchor frame at %fs has %d pairs", anchor, n)
+		}
+	}
+}
+
+func TestLandmarksStayWithinChannels(t *testing.T) {
+	pairing := NewPairing(NewSTFT(2048, 1024), 44100)
+
+	var single, stereo []KeyPoint
+	for frame := range 100 {
+		p := KeyPoint{TimeSec: float64(frame) * pairing.TimeStep, FreqHz: float64(10+rand.Intn(400)) * pairing.FreqStep}
+		single = append(single, p)
+		stereo = append(stereo, p)
+		p.Channel = 1
+		stereo = append(stereo, p)
+	}
+
+	// Both channels carry the same peaks, so each should give the landmarks
+	// of one channel alone and none pair across them.
+	want := make(map[Landmark]int)
+	for _, l := range GetLandmarks(single, pairing) {
+		want[l] += 2
+	}
+	got := make(map[Landmark]int)
+	for _, l := range GetLandmarks(stereo, pairing) {
+		got[l]++
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d distinct landmarks, want %d", len(got), len(want))
+	}
+	for l, n := range want {
+		if got[l] != n {
+			t.Fatalf("landmark %+v found %d times, want %d", l, got[l], n)
+		}
+	}
+}
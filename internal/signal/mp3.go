@@ -0,0 +1,95 @@
+package signal
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// mp3FrameBytes is the size of a frame go-mp3 decodes to: it always produces
+// 16 bit little endian stereo, duplicating mono streams into both channels.
+const mp3FrameBytes = 4
+
+// mp3SeekMargin is how many frames before a seek target decoding resumes.
+// go-mp3 primes a seek with a single mp3 frame, too little to restore the
+// bit reservoir and the overlap of the frames before, so the first few
+// hundred samples after it come out wrong.
+const mp3SeekMargin = 4 * 1152
+
+// mp3Decoder decodes MPEG-1/2 audio layer III through go-mp3. Seeking jumps
+// to an mp3 frame, which go-mp3 indexes when it opens the stream, a few
+// frames before the target and decodes forward from there.
+type mp3Decoder struct {
+	dec *mp3.Decoder
+	buf []byte
+}
+
+func newMP3Decoder(rs io.ReadSeeker) (*mp3Decoder, error) {
+	dec, err := mp3.NewDecoder(rs)
+	if err != nil {
+		return nil, err
+	}
+	return &mp3Decoder{dec: dec}, nil
+}
+
+func (d *mp3Decoder) SampleRate() int {
+	return d.dec.SampleRate()
+}
+
+func (d *mp3Decoder) Channels() int {
+	return 2
+}
+
+func (d *mp3Decoder) Length() int64 {
+	if d.dec.Length() < 0 {
+		return -1
+	}
+	return d.dec.Length() / mp3FrameBytes
+}
+
+func (d *mp3Decoder) Seek(offset int64, whence int) (int64, error) {
+	pos, err := d.dec.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	frame, err := seekTarget(offset, whence, pos/mp3FrameBytes, d.Length())
+	if err != nil {
+		return 0, err
+	}
+	start := max(frame-mp3SeekMargin, 0)
+	if _, err := d.dec.Seek(start*mp3FrameBytes, io.SeekStart); err != nil {
+		return 0, err
+	}
+	skip := make([]byte, (frame-start)*mp3FrameBytes)
+	if _, err := io.ReadFull(d.dec, skip); err != nil {
+		return 0, err
+	}
+	return frame, nil
+}
+
+func (d *mp3Decoder) Read(frames [][]float64) (int, error) {
+	want := len(frames[0]) * mp3FrameBytes
+	if cap(d.buf) < want {
+		d.buf = make([]byte, want)
+	}
+	buf := d.buf[:want]
+
+	read, err := io.ReadFull(d.dec, buf)
+	n := read / mp3FrameBytes
+	for i := range n {
+		for ch := range frames {
+			v := int16(binary.LittleEndian.Uint16(buf[i*mp3FrameBytes+2*ch:]))
+			frames[ch][i] = float64(v) / 32768
+		}
+	}
+
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF) && n > 0:
+		return n, nil
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return 0, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,298 @@
+package signal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// PeakExtractor turns a stream of STFT frames, fed in order, into key
+// points. Extractors that look ahead hold frames back, Flush returns what
+// is left once the stream ends.
+type PeakExtractor interface {
+	Add(frame Frame) []KeyPoint
+	Flush() []KeyPoint
+}
+
+type PeakStrategy string
+
+const (
+	// PeaksBandMax keeps the loudest bin of every band of the layout, frame
+	// by frame.
+	PeaksBandMax PeakStrategy = "bands"
+	// Peaks2D keeps local maxima of the spectrogram that stand out of the
+	// noise floor, thinned to a target density.
+	Peaks2D PeakStrategy = "2d"
+)
+
+func ParsePeakStrategy(spec string) (PeakStrategy, error) {
+	switch s := PeakStrategy(strings.ToLower(spec)); s {
+	case PeaksBandMax, Peaks2D:
+		return s, nil
+	case "band", "bandmax":
+		return PeaksBandMax, nil
+	}
+	return "", fmt.Errorf("unknown peak strategy '%s', expected '%s' or '%s'", spec, PeaksBandMax, Peaks2D)
+}
+
+func (s PeakStrategy) MarshalText() ([]byte, error) {
+	return []byte(s), nil
+}
+
+// UnmarshalText lets a strategy be used directly as a flag value.
+func (s *PeakStrategy) UnmarshalText(text []byte) error {
+	parsed, err := ParsePeakStrategy(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// NewExtractor builds the extractor for frames produced by stft at
+// sampleRate, picking peaks in the bands of layout. density is the target
+// number of peaks per second for Peaks2D, 0 uses the default.
+func (s PeakStrategy) NewExtractor(stft *STFT, sampleRate int, layout BandLayout, density float64) PeakExtractor {
+	if s == PeaksBandMax {
+		return &bandMaxExtractor{bands: layout.Bands, sampleRate: sampleRate, fftSize: stft.TransformSize()}
+	}
+
+	cfg := DefaultPeakPicker
+	cfg.Bands = layout.Bands
+	if density > 0 {
+		cfg.Density = density
+	}
+	return NewPeakPicker(cfg, stft, sampleRate)
+}
+
+type bandMaxExtractor struct {
+	bands      []FreqRange
+	sampleRate int
+	fftSize    int
+}
+
+func (b *bandMaxExtractor) Add(frame Frame) []KeyPoint {
+	return GetFingerprintPoints(frame.Magnitudes, b.bands, b.sampleRate, b.fftSize, frame.Time)
+}
+
+func (b *bandMaxExtractor) Flush() []KeyPoint {
+	return nil
+}
+
+// PeakPickerConfig tunes the 2-D peak picker.
+type PeakPickerConfig struct {
+	// A peak is the maximum of the box of TimeRadius frames and FreqRadius
+	// bins around it.
+	TimeRadius int
+	FreqRadius int
+	// MarginDB is how far above the noise floor of its bin a peak must be,
+	// and SilenceDB an absolute floor below which nothing is kept.
+	MarginDB  float64
+	SilenceDB float64
+	// FloorTime is the time constant in seconds the noise floor rises with;
+	// it falls ten times faster so it tracks the quiet parts of every bin.
+	FloorTime float64
+	// Density is the number of peaks kept per second, the most prominent
+	// ones over the floor win.
+	Density float64
+	MinFreq float64
+	MaxFreq float64
+	// Bands, when set, replaces MinFreq and MaxFreq: peaks outside every
+	// band are dropped.
+	Bands []FreqRange
+}
+
+var DefaultPeakPicker = PeakPickerConfig{
+	TimeRadius: 3,
+	FreqRadius: 8,
+	MarginDB:   6,
+	SilenceDB:  -70,
+	FloorTime:  1,
+	Density:    30,
+	MinFreq:    40,
+	MaxFreq:    10000,
+}
+
+type peakCandidate struct {
+	frame      int
+	point      KeyPoint
+	prominence float64
+}
+
+type peakPicker struct {
+	cfg        PeakPickerConfig
+	freqStep   float64
+	hop        float64
+	minBin     int
+	layout     BandLayout
+	rise, fall float64
+	// blockFrames is the number of frames the density is enforced over.
+	blockFrames int
+
+	// frames keeps the dB spectra of the last 2*TimeRadius+1 frames, the
+	// one in the middle is the next to be searched for peaks.
+	frames [][]float64
+	times  []float64
+	floor  []float64
+	next   int
+	added  int
+
+	block      []peakCandidate
+	blockStart int
+}
+
+// NewPeakPicker returns a Peaks2D extractor for frames produced by stft at
+// sampleRate.
+func NewPeakPicker(cfg PeakPickerConfig, stft *STFT, sampleRate int) PeakExtractor {
+	freqStep := float64(sampleRate) / float64(stft.TransformSize())
+	hop := float64(stft.HopSize) / float64(sampleRate)
+
+	layout := BandLayout{Bands: cfg.Bands}
+	if len(layout.Bands) == 0 {
+		layout.Bands = []FreqRange{{Min: cfg.MinFreq, Max: cfg.MaxFreq}}
+	}
+	cfg.MinFreq, cfg.MaxFreq = layout.Range()
+
+	minBin := max(1, int(math.Ceil(cfg.MinFreq/freqStep)))
+	maxBin := min(stft.Bins()-1, int(cfg.MaxFreq/freqStep))
+	rise := min(1, hop/cfg.FloorTime)
+
+	floor := make([]float64, max(0, maxBin-minBin+1))
+	for i := range floor {
+		floor[i] = cfg.SilenceDB
+	}
+
+	return &peakPicker{
+		cfg:         cfg,
+		freqStep:    freqStep,
+		hop:         hop,
+		minBin:      minBin,
+		layout:      layout,
+		rise:        rise,
+		fall:        min(1, 10*rise),
+		blockFrames: max(1, int(math.Round(1/hop))),
+		floor:       floor,
+	}
+}
+
+func (p *peakPicker) Add(frame Frame) []KeyPoint {
+	db := make([]float64, len(p.floor))
+	for i := range db {
+		db[i] = 20 * math.Log10(frame.Magnitudes[p.minBin+i])
+	}
+
+	for i, v := range db {
+		switch {
+		case math.IsInf(v, -1):
+		case v > p.floor[i]:
+			p.floor[i] += p.rise * (v - p.floor[i])
+		default:
+			p.floor[i] += p.fall * (v - p.floor[i])
+		}
+	}
+
+	p.frames = append(p.frames, db)
+	p.times = append(p.times, frame.Time)
+	p.added++
+
+	var points []KeyPoint
+	for p.next+p.cfg.TimeRadius < p.added {
+		points = append(points, p.search()...)
+	}
+	return points
+}
+
+func (p *peakPicker) Flush() []KeyPoint {
+	var points []KeyPoint
+	for p.next < p.added {
+		points = append(points, p.search()...)
+	}
+	return append(points, p.emitBlock()...)
+}
+
+// search looks for peaks in frame p.next, then drops the frames no later
+// search can reach.
+func (p *peakPicker) search() []KeyPoint {
+	first := p.added - len(p.frames)
+	center := p.next - first
+	spectrum := p.frames[center]
+
+	var points []KeyPoint
+	if p.next-p.blockStart >= p.blockFrames {
+		points = p.emitBlock()
+		p.blockStart = p.next
+	}
+
+	for i, v := range spectrum {
+		if v < p.cfg.SilenceDB || v < p.floor[i]+p.cfg.MarginDB || !p.isLocalMax(center, i) {
+			continue
+		}
+
+		freq := float64(p.minBin+i) * p.freqStep
+		if p.layout.bandOf(freq) < 0 {
+			continue
+		}
+		p.block = append(p.block, peakCandidate{
+			frame: p.next,
+			point: KeyPoint{
+				TimeSec: math.Round(p.times[center]*1000) / 1000,
+				FreqHz:  math.Round(freq),
+				MagDB:   math.Round(v*100) / 100,
+			},
+			prominence: v - p.floor[i],
+		})
+	}
+
+	p.next++
+	if drop := p.next - p.cfg.TimeRadius - first; drop > 0 {
+		p.frames = p.frames[drop:]
+		p.times = p.times[drop:]
+	}
+	return points
+}
+
+// isLocalMax reports whether bin i of frame center is the maximum of its
+// neighbourhood. Ties go to the earliest, lowest bin so a flat plateau
+// yields a single peak.
+func (p *peakPicker) isLocalMax(center, i int) bool {
+	v := p.frames[center][i]
+	for t := max(0, center-p.cfg.TimeRadius); t <= min(len(p.frames)-1, center+p.cfg.TimeRadius); t++ {
+		row := p.frames[t]
+		for k := max(0, i-p.cfg.FreqRadius); k <= min(len(row)-1, i+p.cfg.FreqRadius); k++ {
+			if t == center && k == i {
+				continue
+			}
+			earlier := t < center || t == center && k < i
+			if row[k] > v || earlier && row[k] == v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// emitBlock keeps the most prominent candidates of the current block, as
+// many as the target density allows, in time order.
+func (p *peakPicker) emitBlock() []KeyPoint {
+	limit := int(math.Ceil(p.cfg.Density * float64(p.blockFrames) * p.hop))
+	if p.cfg.Density > 0 && len(p.block) > limit {
+		sort.SliceStable(p.block, func(a, b int) bool {
+			return p.block[a].prominence > p.block[b].prominence
+		})
+		p.block = p.block[:limit]
+	}
+	sort.SliceStable(p.block, func(a, b int) bool {
+		if p.block[a].frame != p.block[b].frame {
+			return p.block[a].frame < p.block[b].frame
+		}
+		return p.block[a].point.FreqHz < p.block[b].point.FreqHz
+	})
+
+	points := make([]KeyPoint, len(p.block))
+	for i, c := range p.block {
+		points[i] = c.point
+	}
+	p.block = p.block[:0]
+	return points
+}
@@ -0,0 +1,78 @@
+package signal
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func pickPeaks(samples []float64, sampleRate int, strategy PeakStrategy, density float64) []KeyPoint {
+	stft := NewSTFT(2048, 1024)
+	extractor := strategy.NewExtractor(stft, sampleRate, DefaultBandLayout, density)
+
+	var points []KeyPoint
+	for frame := range stft.Frames(samples, sampleRate) {
+		points = append(points, extractor.Add(frame)...)
+	}
+	return append(points, extractor.Flush()...)
+}
+
+func TestPeakPickerFindsCloseTones(t *testing.T) {
+	const sampleRate = 44100
+	// The tones fade in over 20ms, a hard onset is a click with peaks all
+	// over the spectrum.
+	const fade = sampleRate / 50
+	noise := rand.New(rand.NewSource(1))
+	samples := make([]float64, 2*sampleRate)
+	for i := sampleRate / 2; i < len(samples); i++ {
+		x := float64(i) / sampleRate
+		gain := 0.5 - 0.5*math.Cos(math.Pi*min(1, float64(i-sampleRate/2)/fade))
+		samples[i] = gain*(0.3*math.Sin(2*math.Pi*1000*x)+0.3*math.Sin(2*math.Pi*1300*x)) + 0.001*(noise.Float64()*2-1)
+	}
+
+	found := map[bool]bool{}
+	for _, p := range pickPeaks(samples, sampleRate, Peaks2D, 0) {
+		switch {
+		case math.Abs(p.FreqHz-1000) < 25:
+			found[false] = true
+		case math.Abs(p.FreqHz-1300) < 25:
+			found[true] = true
+		default:
+			t.Errorf("unexpected peak at %.0f Hz, %.3fs", p.FreqHz, p.TimeSec)
+		}
+		if p.TimeSec < 0.4 {
+			t.Errorf("peak at %.3fs, before the tones start", p.TimeSec)
+		}
+	}
+	if !found[false] || !found[true] {
+		t.Fatalf("missed a tone: 1000 Hz %v, 1300 Hz %v", found[false], found[true])
+	}
+}
+
+func TestPeakPickerDensity(t *testing.T) {
+	const sampleRate = 22050
+	samples := make([]float64, 6*sampleRate)
+	for i := range samples {
+		samples[i] = rand.Float64()*2 - 1
+	}
+
+	bands := pickPeaks(samples, sampleRate, PeaksBandMax, 0)
+	peaks := pickPeaks(samples, sampleRate, Peaks2D, 10)
+	if len(peaks) == 0 || len(peaks) >= len(bands) {
+		t.Fatalf("got %d 2d peaks for %d band maxima", len(peaks), len(bands))
+	}
+
+	perSecond := make(map[int]int)
+	for i, p := range peaks {
+		perSecond[int(p.TimeSec)]++
+		if i > 0 && p.TimeSec < peaks[i-1].TimeSec {
+			t.Fatalf("peak %d at %.3fs is out of order", i, p.TimeSec)
+		}
+	}
+	for second, n := range perSecond {
+		// Blocks are a whole number of frames, so they straddle seconds.
+		if n > 20 {
+			t.Errorf("second %d has %d peaks, target is 10", second, n)
+		}
+	}
+}
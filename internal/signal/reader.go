@@ -0,0 +1,132 @@
+package signal
+
+import "io"
+
+// SampleReader streams a single channel of samples. ReadSamples fills buf
+// and returns io.EOF once no samples are left.
+type SampleReader interface {
+	ReadSamples(buf []float64) (int, error)
+}
+
+// MixReader streams the single signal mode selects out of r. ChannelAll is
+// rejected: split it first and either use MixReaders or seek r back to the
+// start between channels.
+func MixReader(r AudioReader, mode ChannelMode) (SampleReader, error) {
+	readers, err := MixReaders(r, []ChannelMode{mode})
+	if err != nil {
+		return nil, err
+	}
+	return readers[0], nil
+}
+
+type sliceReader struct {
+	samples []float64
+}
+
+// NewSliceReader streams samples already held in memory.
+func NewSliceReader(samples []float64) SampleReader {
+	return &sliceReader{samples: samples}
+}
+
+func (s *sliceReader) ReadSamples(buf []float64) (int, error) {
+	if len(s.samples) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(buf, s.samples)
+	s.samples = s.samples[n:]
+	return n, nil
+}
+
+// MixReaders streams several signals out of one AudioReader, for instance
+// every channel of ChannelAll. The readers share the decoder, so they must
+// be consumed in lockstep: samples one reader has not read yet are queued
+// while the others advance.
+func MixReaders(r AudioReader, modes []ChannelMode) ([]SampleReader, error) {
+	shared := &sharedDecoder{r: r, chunk: make([][]float64, r.Channels())}
+	for ch := range shared.chunk {
+		shared.chunk[ch] = make([]float64, 8192)
+	}
+
+	readers := make([]SampleReader, len(modes))
+	for i, mode := range modes {
+		weights, err := mode.weights(r.Channels())
+		if err != nil {
+			return nil, err
+		}
+		shared.queues = append(shared.queues, nil)
+		shared.weights = append(shared.weights, weights)
+		readers[i] = &queuedReader{shared: shared, index: i}
+	}
+	return readers, nil
+}
+
+type sharedDecoder struct {
+	r       AudioReader
+	chunk   [][]float64
+	weights [][]float64
+	queues  [][]float64
+	err     error
+}
+
+func (s *sharedDecoder) fill() {
+	n, err := s.r.Read(s.chunk)
+	for i, weights := range s.weights {
+		start := len(s.queues[i])
+		s.queues[i] = append(s.queues[i], make([]float64, n)...)
+		mixed := s.queues[i][start:]
+		for ch, w := range weights {
+			if w == 0 {
+				continue
+			}
+			for j, v := range s.chunk[ch][:n] {
+				mixed[j] += w * v
+			}
+		}
+	}
+	s.err = err
+}
+
+type queuedReader struct {
+	shared *sharedDecoder
+	index  int
+}
+
+func (q *queuedReader) ReadSamples(buf []float64) (int, error) {
+	s := q.shared
+	if len(s.queues[q.index]) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.fill()
+	}
+
+	queue := s.queues[q.index]
+	n := copy(buf, queue)
+	s.queues[q.index] = queue[:copy(queue, queue[n:])]
+	if n == 0 {
+		return 0, s.err
+	}
+	return n, nil
+}
+
+type limitedReader struct {
+	r    SampleReader
+	left int64
+}
+
+// LimitSamples stops r after n samples.
+func LimitSamples(r SampleReader, n int64) SampleReader {
+	return &limitedReader{r: r, left: n}
+}
+
+func (l *limitedReader) ReadSamples(buf []float64) (int, error) {
+	if l.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(buf)) > l.left {
+		buf = buf[:l.left]
+	}
+	n, err := l.r.ReadSamples(buf)
+	l.left -= int64(n)
+	return n, err
+}
@@ -0,0 +1,214 @@
+package signal
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// AnalysisSampleRate is the rate every signal is converted to before it is
+// fingerprinted, so that a window of a fixed number of samples spans the same
+// time and frequency resolution whatever rate the file was recorded at.
+const AnalysisSampleRate = 44100
+
+const (
+	// resampleZeroCrossings is the number of sinc zero crossings kept on each
+	// side of the filter centre, at the filter's own cutoff.
+	resampleZeroCrossings = 32
+	// resampleRolloff places the cutoff slightly below the lower Nyquist
+	// frequency so the transition band does not alias.
+	resampleRolloff = 0.95
+	resampleBeta    = 9.0
+	// resampleMaxPhases bounds the filter bank for ratios with a large
+	// numerator; positions are then truncated to one of that many phases, a
+	// timing error below 1/1024 of an input sample.
+	resampleMaxPhases = 1024
+)
+
+// polyphaseFilter holds a Kaiser windowed sinc low-pass filter split into
+// phases, one per fractional input position the resampler visits.
+type polyphaseFilter struct {
+	up, down int
+	phases   int
+	// halfWidth is the number of input samples on each side of an output
+	// sample that contribute to it.
+	halfWidth int
+	taps      [][]float64
+}
+
+var filterCache sync.Map
+
+func planResampleFilter(from, to int) *polyphaseFilter {
+	g := gcd(from, to)
+	up, down := to/g, from/g
+	key := [2]int{up, down}
+	if f, ok := filterCache.Load(key); ok {
+		return f.(*polyphaseFilter)
+	}
+
+	cutoff := resampleRolloff * min(1, float64(up)/float64(down))
+	halfWidth := int(math.Ceil(resampleZeroCrossings / cutoff))
+	phases := min(up, resampleMaxPhases)
+	norm := besselI0(resampleBeta)
+
+	taps := make([][]float64, phases)
+	for p := range taps {
+		frac := float64(p) / float64(phases)
+		taps[p] = make([]float64, 2*halfWidth)
+		for k := range taps[p] {
+			// Distance from the output position to input sample
+			// i-halfWidth+1+k, where i is the integer part of the position.
+			t := float64(halfWidth-1-k) + frac
+			x := t / float64(halfWidth)
+			if x <= -1 || x >= 1 {
+				continue
+			}
+			window := besselI0(resampleBeta*math.Sqrt(1-x*x)) / norm
+			taps[p][k] = cutoff * sinc(cutoff*t) * window
+		}
+	}
+
+	f, _ := filterCache.LoadOrStore(key, &polyphaseFilter{
+		up:        up,
+		down:      down,
+		phases:    phases,
+		halfWidth: halfWidth,
+		taps:      taps,
+	})
+	return f.(*polyphaseFilter)
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// resampler converts a SampleReader from one rate to another while it is
+// read, keeping only the filter's support and one input chunk in memory.
+type resampler struct {
+	src    SampleReader
+	filter *polyphaseFilter
+
+	// buf holds input samples from absolute index start onwards; the
+	// signal is preceded by halfWidth-1 zeros so the first outputs see a
+	// full filter.
+	buf   []float64
+	start int64
+	chunk []float64
+
+	// The next output sample sits at input position pos + phase/up.
+	pos   int64
+	phase int
+	out   int64
+	// total is the number of output samples, known once src is drained.
+	total int64
+	eof   bool
+}
+
+// NewResampler converts r from sample rate from to sample rate to with a
+// band-limited windowed sinc interpolator. It returns r itself when the
+// rates match.
+func NewResampler(r SampleReader, from, to int) (SampleReader, error) {
+	if from < 1 || to < 1 {
+		return nil, fmt.Errorf("invalid resampling from %d Hz to %d Hz", from, to)
+	}
+	if from == to {
+		return r, nil
+	}
+
+	filter := planResampleFilter(from, to)
+	return &resampler{
+		src:    r,
+		filter: filter,
+		buf:    make([]float64, filter.halfWidth-1),
+		start:  -int64(filter.halfWidth - 1),
+		chunk:  make([]float64, 8192),
+		total:  -1,
+	}, nil
+}
+
+func (r *resampler) ReadSamples(out []float64) (int, error) {
+	f := r.filter
+
+	n := 0
+	for n < len(out) {
+		last := r.pos + int64(f.halfWidth)
+		for !r.eof && r.start+int64(len(r.buf)) <= last {
+			if err := r.fill(); err != nil {
+				return n, err
+			}
+		}
+		if r.eof && r.out >= r.total {
+			break
+		}
+
+		first := int(r.pos - int64(f.halfWidth) + 1 - r.start)
+		taps := f.taps[r.phase*f.phases/f.up]
+		sum := 0.0
+		for k, x := range r.buf[first : first+len(taps)] {
+			sum += taps[k] * x
+		}
+		out[n] = sum
+		n++
+		r.out++
+
+		r.phase += f.down
+		r.pos += int64(r.phase / f.up)
+		r.phase %= f.up
+	}
+
+	if n == 0 && r.eof && r.out >= r.total {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (r *resampler) fill() error {
+	// Drop the samples no later output can reach before appending more.
+	if drop := int(r.pos - int64(r.filter.halfWidth) + 1 - r.start); drop > len(r.chunk) {
+		r.buf = r.buf[:copy(r.buf, r.buf[drop:])]
+		r.start += int64(drop)
+	}
+
+	n, err := r.src.ReadSamples(r.chunk)
+	r.buf = append(r.buf, r.chunk[:n]...)
+	if err == io.EOF {
+		inputs := r.start + int64(len(r.buf))
+		r.total = (inputs*int64(r.filter.up) + int64(r.filter.down) - 1) / int64(r.filter.down)
+		r.buf = append(r.buf, make([]float64, r.filter.halfWidth)...)
+		r.eof = true
+		return nil
+	}
+	return err
+}
+
+// Resample converts samples held in memory from one rate to another.
+func Resample(samples []float64, from, to int) ([]float64, error) {
+	r, err := NewResampler(NewSliceReader(samples), from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []float64
+	buf := make([]float64, 8192)
+	for {
+		n, err := r.ReadSamples(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
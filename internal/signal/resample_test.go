@@ -0,0 +1,90 @@
+package signal
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestResamplePreservesSine(t *testing.T) {
+	rates := [][2]int{{48000, 44100}, {16000, 44100}, {44100, 22050}, {44100, 8000}, {44100, 48001}}
+
+	for _, r := range rates {
+		from, to := r[0], r[1]
+		samples := make([]float64, from/2)
+		for i := range samples {
+			samples[i] = 0.8 * math.Sin(2*math.Pi*1000*float64(i)/float64(from))
+		}
+
+		out, err := Resample(samples, from, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (len(samples)*to + from - 1) / from; len(out) != want {
+			t.Fatalf("%d -> %d Hz: got %d samples, want %d", from, to, len(out), want)
+		}
+
+		// The filter reaches past both ends of the signal, skip those edges.
+		edge := 200
+		for i := edge; i < len(out)-edge; i++ {
+			want := 0.8 * math.Sin(2*math.Pi*1000*float64(i)/float64(to))
+			if math.Abs(out[i]-want) > 1e-3 {
+				t.Fatalf("%d -> %d Hz sample %d: got %f, want %f", from, to, i, out[i], want)
+			}
+		}
+	}
+}
+
+func TestResampleRemovesAliases(t *testing.T) {
+	// 15 kHz cannot be represented at 22050 Hz and must be filtered out
+	// rather than folded back to 7050 Hz.
+	samples := make([]float64, 44100)
+	for i := range samples {
+		samples[i] = math.Sin(2 * math.Pi * 15000 * float64(i) / 44100)
+	}
+
+	out, err := Resample(samples, 44100, 22050)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 200; i < len(out)-200; i++ {
+		if math.Abs(out[i]) > 1e-3 {
+			t.Fatalf("sample %d: got %f, want silence", i, out[i])
+		}
+	}
+}
+
+func TestResamplerStreamsInChunks(t *testing.T) {
+	samples := make([]float64, 30000)
+	for i := range samples {
+		samples[i] = rand.Float64()*2 - 1
+	}
+
+	want, err := Resample(samples, 44100, 48000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewResampler(&chunkedReader{samples: samples, size: 777}, 44100, 48000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []float64
+	buf := make([]float64, 1000)
+	for {
+		n, err := r.ReadSamples(buf[:1+rand.Intn(len(buf))])
+		got = append(got, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d samples, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample %d: got %f, want %f", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package signal
+
+import (
+	"fmt"
+	"math/cmplx"
+	"sync"
+)
+
+// RealFFTPlan computes the spectrum of n real samples as n/2+1 bins. Even
+// sizes pack even and odd samples into one complex transform of size n/2;
+// odd sizes fall back to a full complex transform.
+type RealFFTPlan struct {
+	n        int
+	half     *FFTPlan
+	full     *FFTPlan
+	twiddles []complex128
+	scratch  sync.Pool
+}
+
+var realFFTPlans sync.Map
+
+func NewRealFFTPlan(n int) *RealFFTPlan {
+	if n < 1 {
+		panic(fmt.Sprintf("signal: invalid real FFT size %d", n))
+	}
+
+	if n%2 != 0 {
+		p := &RealFFTPlan{n: n, full: PlanFFT(n)}
+		p.scratch.New = func() any {
+			buf := make([]complex128, n)
+			return &buf
+		}
+		return p
+	}
+
+	twiddles := make([]complex128, n/2+1)
+	for k := range twiddles {
+		twiddles[k] = unitRoot(k, n)
+	}
+
+	p := &RealFFTPlan{n: n, half: PlanFFT(n / 2), twiddles: twiddles}
+	p.scratch.New = func() any {
+		buf := make([]complex128, n/2)
+		return &buf
+	}
+	return p
+}
+
+func PlanRealFFT(n int) *RealFFTPlan {
+	if p, ok := realFFTPlans.Load(n); ok {
+		return p.(*RealFFTPlan)
+	}
+	p, _ := realFFTPlans.LoadOrStore(n, NewRealFFTPlan(n))
+	return p.(*RealFFTPlan)
+}
+
+func (p *RealFFTPlan) Size() int {
+	return p.n
+}
+
+func (p *RealFFTPlan) Bins() int {
+	return p.n/2 + 1
+}
+
+// Transform writes bins 0..n/2 of the spectrum of src into dst, which must
+// have length Bins().
+func (p *RealFFTPlan) Transform(dst []complex128, src []float64) {
+	if len(src) != p.n || len(dst) != p.Bins() {
+		panic(fmt.Sprintf("signal: real FFT plan of size %d used with %d samples and %d bins", p.n, len(src), len(dst)))
+	}
+
+	if p.full != nil {
+		bufPtr := p.scratch.Get().(*[]complex128)
+		defer p.scratch.Put(bufPtr)
+		buf := *bufPtr
+		for i, v := range src {
+			buf[i] = complex(v, 0)
+		}
+		p.full.Transform(buf, buf)
+		copy(dst, buf)
+		return
+	}
+
+	h := p.n / 2
+	z := dst[:h]
+	for i := range z {
+		z[i] = complex(src[2*i], src[2*i+1])
+	}
+	p.half.Transform(z, z)
+
+	z0 := z[0]
+	dst[0] = complex(real(z0)+imag(z0), 0)
+	dst[h] = complex(real(z0)-imag(z0), 0)
+
+	for k := 1; k <= h/2; k++ {
+		m := h - k
+		zk, zm := z[k], z[m]
+		dst[k] = p.split(zk, zm, k)
+		dst[m] = p.split(zm, zk, m)
+	}
+}
+
+// Inverse reconstructs the n real samples whose half spectrum is src.
+func (p *RealFFTPlan) Inverse(dst []float64, src []complex128) {
+	if len(dst) != p.n || len(src) != p.Bins() {
+		panic(fmt.Sprintf("signal: real FFT plan of size %d used with %d samples and %d bins", p.n, len(dst), len(src)))
+	}
+
+	bufPtr := p.scratch.Get().(*[]complex128)
+	defer p.scratch.Put(bufPtr)
+	z := *bufPtr
+
+	if p.full != nil {
+		copy(z, src)
+		for k := len(src); k < p.n; k++ {
+			z[k] = cmplx.Conj(src[p.n-k])
+		}
+		p.full.Inverse(z, z)
+		for i, v := range z {
+			dst[i] = real(v)
+		}
+		return
+	}
+
+	h := p.n / 2
+	for k := range z {
+		xk, xm := src[k], cmplx.Conj(src[h-k])
+		even := 0.5 * (xk + xm)
+		odd := 0.5 * (xk - xm) * cmplx.Conj(p.twiddles[k])
+		z[k] = even + complex(0, 1)*odd
+	}
+	p.half.Inverse(z, z)
+
+	for i, v := range z {
+		dst[2*i] = real(v)
+		dst[2*i+1] = imag(v)
+	}
+}
+
+// split recovers bin k of the real spectrum from bins k and n/2-k of the
+// packed half-size transform.
+func (p *RealFFTPlan) split(zk, zm complex128, k int) complex128 {
+	even := 0.5 * (zk + cmplx.Conj(zm))
+	odd := complex(0, -0.5) * (zk - cmplx.Conj(zm))
+	return even + p.twiddles[k]*odd
+}
+
+// RFFT returns the len(x)/2+1 non-negative frequency bins of x.
+func RFFT(x []float64) []complex128 {
+	if len(x) == 0 {
+		return []complex128{}
+	}
+
+	plan := PlanRealFFT(len(x))
+	result := make([]complex128, plan.Bins())
+	plan.Transform(result, x)
+	return result
+}
+
+// IRFFT inverts the half spectrum of n real samples.
+func IRFFT(spectrum []complex128, n int) []float64 {
+	result := make([]float64, n)
+	if n == 0 {
+		return result
+	}
+
+	PlanRealFFT(n).Inverse(result, spectrum)
+	return result
+}
+
+// ComputeRealMagnitudes scales the half spectrum of n real samples to peak
+// amplitudes, mirroring ComputeMagnitudes for full complex spectra.
+func ComputeRealMagnitudes(spectrum []complex128, n int) []float64 {
+	magnitudes := make([]float64, len(spectrum))
+	for i, v := range spectrum {
+		magnitudes[i] = cmplx.Abs(v) * 2.0 / float64(n)
+	}
+	if n == 0 || len(spectrum) == 0 {
+		return magnitudes
+	}
+
+	magnitudes[0] /= 2
+	if n%2 == 0 {
+		magnitudes[n/2] /= 2
+	}
+
+	return magnitudes
+}
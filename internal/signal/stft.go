@@ -0,0 +1,273 @@
+package signal
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"runtime"
+	"sync"
+)
+
+// STFT slices a signal into overlapping windowed frames and transforms each
+// one with a real FFT. The zero value is not usable; build it with NewSTFT
+// and adjust the exported fields before calling Frames.
+type STFT struct {
+	WindowSize int
+	HopSize    int
+	Window     Window
+	// FFTSize zero pads every frame to this many samples before the FFT.
+	// Zero means WindowSize.
+	FFTSize int
+	// Center pads the signal with WindowSize/2 zeros on both sides, so frame
+	// k is centred on sample k*HopSize and the tail is analyzed too.
+	Center bool
+}
+
+type Frame struct {
+	Index int
+	// Time is the position of the frame in seconds: its first sample, or its
+	// centre when the STFT is centred.
+	Time     float64
+	Spectrum []complex128
+	// Magnitudes are peak amplitudes corrected for the window's coherent
+	// gain.
+	Magnitudes []float64
+}
+
+func NewSTFT(windowSize, hopSize int) *STFT {
+	return &STFT{
+		WindowSize: windowSize,
+		HopSize:    hopSize,
+		Window:     Hann,
+	}
+}
+
+// TransformSize is the FFT length after zero padding.
+func (s *STFT) TransformSize() int {
+	if s.FFTSize > 0 {
+		return max(s.FFTSize, s.WindowSize)
+	}
+	return s.WindowSize
+}
+
+// Bins is the number of frequency bins in every frame.
+func (s *STFT) Bins() int {
+	return s.TransformSize()/2 + 1
+}
+
+// BinFrequency converts a bin index into Hz for the given sample rate.
+func (s *STFT) BinFrequency(bin int, sampleRate int) float64 {
+	return float64(bin) * float64(sampleRate) / float64(s.TransformSize())
+}
+
+// FrameCount is the number of frames Frames yields for numSamples samples.
+func (s *STFT) FrameCount(numSamples int) int {
+	if s.Center {
+		numSamples += 2 * (s.WindowSize / 2)
+	}
+	if numSamples < s.WindowSize {
+		return 0
+	}
+	return (numSamples-s.WindowSize)/s.HopSize + 1
+}
+
+// Frames yields every frame of samples in order. Frames are computed in
+// batches spread across all CPU cores.
+func (s *STFT) Frames(samples []float64, sampleRate int) iter.Seq[Frame] {
+	return func(yield func(Frame) bool) {
+		s.validate()
+		padding := s.padding()
+
+		count := s.FrameCount(len(samples))
+		window := s.Window.Func(s.WindowSize)
+		batch := make([]Frame, runtime.NumCPU()*4)
+
+		for start := 0; start < count; start += len(batch) {
+			end := min(start+len(batch), count)
+			s.computeBatch(batch[:end-start], samples, window, start, start*s.HopSize-padding, sampleRate)
+
+			for _, frame := range batch[:end-start] {
+				if !yield(frame) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Stream yields the same frames as Frames while reading the signal from r
+// incrementally, so only one batch of frames worth of samples is held in
+// memory at a time. Iteration stops after the first read error.
+func (s *STFT) Stream(r SampleReader, sampleRate int) iter.Seq2[Frame, error] {
+	return func(yield func(Frame, error) bool) {
+		s.validate()
+		padding := s.padding()
+
+		window := s.Window.Func(s.WindowSize)
+		batch := make([]Frame, runtime.NumCPU()*4)
+		span := (len(batch)-1)*s.HopSize + s.WindowSize
+
+		// pending holds the padded signal from the first sample of the next
+		// frame onwards; skip counts samples to drop when the hop is larger
+		// than the window.
+		pending := make([]float64, padding, span+padding)
+		chunk := make([]float64, 8192)
+		skip := 0
+		eof := false
+
+		for index := 0; ; {
+			for !eof && len(pending) < span {
+				n, err := r.ReadSamples(chunk)
+				drop := min(skip, n)
+				skip -= drop
+				pending = append(pending, chunk[drop:n]...)
+
+				if err == io.EOF {
+					eof = true
+					pending = append(pending, make([]float64, padding)...)
+				} else if err != nil {
+					yield(Frame{}, err)
+					return
+				}
+			}
+
+			if len(pending) < s.WindowSize {
+				return
+			}
+			count := min(len(batch), (len(pending)-s.WindowSize)/s.HopSize+1)
+			s.computeBatch(batch[:count], pending, window, index, 0, sampleRate)
+
+			for _, frame := range batch[:count] {
+				if !yield(frame, nil) {
+					return
+				}
+			}
+
+			index += count
+			if consumed := count * s.HopSize; consumed < len(pending) {
+				pending = pending[:copy(pending, pending[consumed:])]
+			} else {
+				skip = consumed - len(pending)
+				pending = pending[:0]
+			}
+		}
+	}
+}
+
+func (s *STFT) validate() {
+	if s.WindowSize < 1 || s.HopSize < 1 {
+		panic(fmt.Sprintf("signal: invalid STFT window %d and hop %d", s.WindowSize, s.HopSize))
+	}
+}
+
+func (s *STFT) padding() int {
+	if s.Center {
+		return s.WindowSize / 2
+	}
+	return 0
+}
+
+// computeBatch fills batch with consecutive frames starting at frame index
+// first, whose first sample sits at offset in samples.
+func (s *STFT) computeBatch(batch []Frame, samples, window []float64, first, offset, sampleRate int) {
+	workers := min(runtime.NumCPU(), len(batch))
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]float64, s.TransformSize())
+			for i := w; i < len(batch); i += workers {
+				batch[i] = s.frame(samples, window, buf, first+i, offset+i*s.HopSize, sampleRate)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// FrameAt analyzes the single frame starting at sample offset, treating
+// samples outside the signal as zeros.
+func (s *STFT) FrameAt(samples []float64, offset int, sampleRate int) Frame {
+	window := s.Window.Func(s.WindowSize)
+	buf := make([]float64, s.TransformSize())
+	frame := s.frame(samples, window, buf, 0, offset, sampleRate)
+	frame.Time = float64(offset) / float64(sampleRate)
+	return frame
+}
+
+func (s *STFT) frame(samples, window, buf []float64, index, offset, sampleRate int) Frame {
+	clear(buf)
+	for j, w := range window {
+		if i := offset + j; i >= 0 && i < len(samples) {
+			buf[j] = samples[i] * w
+		}
+	}
+
+	plan := PlanRealFFT(len(buf))
+	spectrum := make([]complex128, plan.Bins())
+	plan.Transform(spectrum, buf)
+
+	return Frame{
+		Index:      index,
+		Time:       float64(index*s.HopSize) / float64(sampleRate),
+		Spectrum:   spectrum,
+		Magnitudes: ComputeCalibratedMagnitudes(spectrum, len(buf), window),
+	}
+}
+
+// ComputeSTFT returns the half spectra of samples framed by window and
+// advanced by hopSize.
+func ComputeSTFT(samples []float64, window []float64, hopSize int) [][]complex128 {
+	stft := &STFT{
+		WindowSize: len(window),
+		HopSize:    hopSize,
+		Window:     Window{Name: "custom", Func: func(int) []float64 { return window }},
+	}
+
+	var frames [][]complex128
+	for frame := range stft.Frames(samples, 1) {
+		frames = append(frames, frame.Spectrum)
+	}
+
+	return frames
+}
+
+// ISTFT resynthesizes a signal from half spectra produced by ComputeSTFT
+// with the same window and hop size. Overlapping frames are windowed again,
+// added together and divided by the summed squared window, so samples the
+// window never covers with a non-zero weight come out as zero.
+func ISTFT(frames [][]complex128, window []float64, hopSize int) []float64 {
+	if len(frames) == 0 {
+		return nil
+	}
+
+	windowSize := len(window)
+	length := (len(frames)-1)*hopSize + windowSize
+	output := make([]float64, length)
+	windowSum := make([]float64, length)
+
+	for m, frame := range frames {
+		if len(frame) != windowSize/2+1 {
+			panic(fmt.Sprintf("signal: ISTFT frame of %d bins does not match window of %d samples", len(frame), windowSize))
+		}
+		segment := IRFFT(frame, windowSize)
+
+		offset := m * hopSize
+		for j, w := range window {
+			output[offset+j] += segment[j] * w
+			windowSum[offset+j] += w * w
+		}
+	}
+
+	const epsilon = 1e-10
+	for i, sum := range windowSum {
+		if sum > epsilon {
+			output[i] /= sum
+		} else {
+			output[i] = 0
+		}
+	}
+
+	return output
+}
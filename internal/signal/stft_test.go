@@ -0,0 +1,155 @@
+package signal
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestIFFTInvertsFFT(t *testing.T) {
+	input := generateRandomData(512)
+	assertSpectraClose(t, IFFT(FFT(input)), input, 1e-12)
+}
+
+func TestIRFFTInvertsRFFT(t *testing.T) {
+	for _, n := range []int{1024, 3000, 1023} {
+		samples := make([]float64, n)
+		for i := range samples {
+			samples[i] = rand.Float64()*2 - 1
+		}
+
+		restored := IRFFT(RFFT(samples), len(samples))
+		for i := range samples {
+			if math.Abs(restored[i]-samples[i]) > 1e-11 {
+				t.Fatalf("n=%d sample %d: got %f, want %f", n, i, restored[i], samples[i])
+			}
+		}
+	}
+}
+
+func TestISTFTReconstructsSignal(t *testing.T) {
+	windowSize := 2048
+	hopSize := windowSize / 2
+	samples := make([]float64, 44100)
+	for i := range samples {
+		tm := float64(i) / 44100
+		samples[i] = 0.6*math.Sin(2*math.Pi*440*tm) + 0.2*(rand.Float64()*2-1)
+	}
+
+	window := HanningWindow(windowSize)
+	restored := ISTFT(ComputeSTFT(samples, window, hopSize), window, hopSize)
+
+	// The outermost samples sit under the near-zero tails of the Hann window.
+	edge := 8
+	if len(restored) < len(samples)-windowSize {
+		t.Fatalf("restored only %d of %d samples", len(restored), len(samples))
+	}
+	for i := edge; i < len(restored)-edge; i++ {
+		if math.Abs(restored[i]-samples[i]) > 1e-9 {
+			t.Fatalf("sample %d: got %f, want %f", i, restored[i], samples[i])
+		}
+	}
+}
+
+func TestSTFTFramesInOrder(t *testing.T) {
+	samples := make([]float64, 20000)
+	for i := range samples {
+		samples[i] = rand.Float64()*2 - 1
+	}
+
+	stft := NewSTFT(1000, 300)
+	window := HanningWindow(1000)
+	count := 0
+	for frame := range stft.Frames(samples, 8000) {
+		if frame.Index != count {
+			t.Fatalf("got frame %d at position %d", frame.Index, count)
+		}
+		if want := float64(count*300) / 8000; frame.Time != want {
+			t.Fatalf("frame %d: got time %f, want %f", count, frame.Time, want)
+		}
+
+		chunk := make([]float64, 1000)
+		for j := range chunk {
+			chunk[j] = samples[count*300+j] * window[j]
+		}
+		assertSpectraClose(t, frame.Spectrum, RFFT(chunk), 1e-9)
+		count++
+	}
+
+	if count != stft.FrameCount(len(samples)) || count != (20000-1000)/300+1 {
+		t.Fatalf("got %d frames, FrameCount says %d", count, stft.FrameCount(len(samples)))
+	}
+}
+
+func TestSTFTCenteredCoversTail(t *testing.T) {
+	stft := NewSTFT(512, 256)
+	stft.Center = true
+	stft.FFTSize = 1024
+
+	samples := make([]float64, 4096)
+	samples[len(samples)-1] = 1
+
+	var last Frame
+	for frame := range stft.Frames(samples, 4096) {
+		last = frame
+	}
+
+	if len(last.Spectrum) != 513 {
+		t.Fatalf("got %d bins, want 513", len(last.Spectrum))
+	}
+	if last.Time != 1.0 || last.Magnitudes[0] == 0 {
+		t.Fatalf("last frame at %fs does not cover the final sample", last.Time)
+	}
+}
+
+// chunkedReader returns at most size samples per call, to exercise reads
+// that do not line up with frame boundaries.
+type chunkedReader struct {
+	samples []float64
+	size    int
+}
+
+func (c *chunkedReader) ReadSamples(buf []float64) (int, error) {
+	if len(c.samples) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(buf[:min(len(buf), c.size)], c.samples)
+	c.samples = c.samples[n:]
+	return n, nil
+}
+
+func TestSTFTStreamMatchesFrames(t *testing.T) {
+	samples := make([]float64, 50000)
+	for i := range samples {
+		samples[i] = rand.Float64()*2 - 1
+	}
+
+	cases := []struct{ window, hop int }{{1024, 256}, {512, 512}, {256, 700}}
+	for _, c := range cases {
+		for _, center := range []bool{false, true} {
+			stft := NewSTFT(c.window, c.hop)
+			stft.Center = center
+
+			var want []Frame
+			for frame := range stft.Frames(samples, 44100) {
+				want = append(want, frame)
+			}
+
+			i := 0
+			for frame, err := range stft.Stream(&chunkedReader{samples: samples, size: 3001}, 44100) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i >= len(want) || frame.Index != want[i].Index || frame.Time != want[i].Time {
+					t.Fatalf("window %d hop %d center %v: unexpected frame %d", c.window, c.hop, center, frame.Index)
+				}
+				assertSpectraClose(t, frame.Spectrum, want[i].Spectrum, 0)
+				i++
+			}
+			if i != len(want) {
+				t.Fatalf("window %d hop %d center %v: got %d frames, want %d", c.window, c.hop, center, i, len(want))
+			}
+		}
+	}
+}
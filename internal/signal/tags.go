@@ -0,0 +1,360 @@
+package signal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// Tags are the descriptive fields embedded in an audio file. Fields the file
+// does not have are left empty.
+type Tags struct {
+	Title  string
+	Artist string
+	Album  string
+}
+
+// set fills the fields of t that are still empty, so that the first tag
+// found for a field wins.
+func (t *Tags) set(field *string, value string) {
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	if *field == "" {
+		*field = value
+	}
+}
+
+// maxTagSize bounds the chunks and blocks read looking for tags, to skip
+// embedded artwork and not trust a corrupt size.
+const maxTagSize = 1 << 20
+
+// ReadTags reads the tags of an audio file: WAV LIST/INFO chunks, AIFF text
+// chunks, FLAC and Ogg Vorbis comments and ID3v2 tags, at the start of the file or
+// in an "id3 " chunk. A file without tags is not an error.
+func ReadTags(path string) (Tags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Tags{}, err
+	}
+	defer f.Close()
+
+	var tags Tags
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+
+	if bytes.HasPrefix(header, []byte("ID3")) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return tags, err
+		}
+		size, err := readID3(f, &tags)
+		if err != nil {
+			return tags, err
+		}
+		// FLAC files are sometimes prefixed with an ID3 tag.
+		if _, err := f.Seek(size, io.SeekStart); err != nil {
+			return tags, err
+		}
+		header = make([]byte, 12)
+		n, _ := io.ReadFull(f, header)
+		header = header[:n]
+	}
+
+	switch SniffFormat(header) {
+	case FormatWAV:
+		err = readRIFFTags(f, binary.LittleEndian, &tags)
+	case FormatAIFF:
+		err = readRIFFTags(f, binary.BigEndian, &tags)
+	case FormatFLAC:
+		if _, err := f.Seek(int64(4-len(header)), io.SeekCurrent); err != nil {
+			return tags, err
+		}
+		err = readFLACTags(f, &tags)
+	case FormatVorbis, FormatOgg:
+		// The header is too short to tell Ogg codecs apart, readOggTags
+		// checks for Vorbis.
+		if _, err := f.Seek(int64(-len(header)), io.SeekCurrent); err != nil {
+			return tags, err
+		}
+		err = readOggTags(f, &tags)
+	}
+	if err != nil {
+		return tags, fmt.Errorf("reading the tags of '%s': %w", path, err)
+	}
+	return tags, nil
+}
+
+// readRIFFTags walks the chunks of a WAV (little endian) or AIFF (big endian)
+// file, r positioned after the 12 byte header.
+func readRIFFTags(r io.ReadSeeker, order binary.ByteOrder, tags *Tags) error {
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil
+		}
+		id := string(header[0:4])
+		size := int64(order.Uint32(header[4:8]))
+		next := size + size%2
+
+		var body []byte
+		switch id {
+		case "LIST", "id3 ", "ID3 ", "NAME", "AUTH":
+			if size > maxTagSize {
+				break
+			}
+			body = make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return err
+			}
+			next -= size
+		}
+
+		switch id {
+		case "LIST":
+			if len(body) >= 4 && string(body[:4]) == "INFO" {
+				parseRIFFInfo(body[4:], tags)
+			}
+		case "id3 ", "ID3 ":
+			if body != nil {
+				readID3(bytes.NewReader(body), tags)
+			}
+		case "NAME":
+			tags.set(&tags.Title, string(body))
+		case "AUTH":
+			tags.set(&tags.Artist, string(body))
+		}
+
+		if _, err := r.Seek(next, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+}
+
+// parseRIFFInfo reads the sub-chunks of a LIST/INFO chunk.
+func parseRIFFInfo(b []byte, tags *Tags) {
+	for len(b) >= 8 {
+		id := string(b[:4])
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		if size > len(b)-8 {
+			return
+		}
+		value := string(b[8 : 8+size])
+		switch id {
+		case "INAM":
+			tags.set(&tags.Title, value)
+		case "IART":
+			tags.set(&tags.Artist, value)
+		case "IPRD":
+			tags.set(&tags.Album, value)
+		}
+		b = b[min(len(b), 8+size+size%2):]
+	}
+}
+
+// readFLACTags reads the VORBIS_COMMENT block of a FLAC stream, r positioned
+// after the "fLaC" marker.
+func readFLACTags(r io.ReadSeeker, tags *Tags) error {
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		if blockType == 4 {
+			body := make([]byte, length)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return err
+			}
+			parseVorbisComments(body, tags)
+			return nil
+		}
+		if last {
+			return nil
+		}
+		if _, err := r.Seek(length, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+}
+
+// parseVorbisComments reads a vendor string and the NAME=value comments that
+// follow, all lengths little endian.
+func parseVorbisComments(b []byte, tags *Tags) {
+	next := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := int(binary.LittleEndian.Uint32(b))
+		if n > len(b)-4 {
+			return "", false
+		}
+		s := string(b[4 : 4+n])
+		b = b[4+n:]
+		return s, true
+	}
+
+	if _, ok := next(); !ok {
+		return
+	}
+	if len(b) < 4 {
+		return
+	}
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+	for range count {
+		comment, ok := next()
+		if !ok {
+			return
+		}
+		setVorbisComment(comment, tags)
+	}
+}
+
+// readOggTags reads the comment header of an Ogg Vorbis stream. Other Ogg
+// codecs are skipped.
+func readOggTags(r io.Reader, tags *Tags) error {
+	header, err := oggvorbis.GetCommentHeader(r)
+	if err != nil {
+		return nil
+	}
+	for _, comment := range header.Comments {
+		setVorbisComment(comment, tags)
+	}
+	return nil
+}
+
+func setVorbisComment(comment string, tags *Tags) {
+	name, value, _ := strings.Cut(comment, "=")
+	switch strings.ToUpper(name) {
+	case "TITLE":
+		tags.set(&tags.Title, value)
+	case "ARTIST":
+		tags.set(&tags.Artist, value)
+	case "ALBUM":
+		tags.set(&tags.Album, value)
+	}
+}
+
+// readID3 reads an ID3v2.2, v2.3 or v2.4 tag at the start of r and returns
+// its size including the header.
+func readID3(r io.Reader, tags *Tags) (int64, error) {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	if string(header[:3]) != "ID3" {
+		return 0, fmt.Errorf("not an ID3 tag")
+	}
+	version, flags := header[3], header[5]
+	size := syncsafe(header[6:10])
+	total := int64(10 + size)
+	if flags&0x10 != 0 {
+		total += 10 // footer
+	}
+	if size > maxTagSize {
+		return total, nil
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, err
+	}
+	if flags&0x80 != 0 && version < 4 {
+		body = bytes.ReplaceAll(body, []byte{0xff, 0x00}, []byte{0xff})
+	}
+	if flags&0x40 != 0 && version >= 3 && len(body) >= 4 {
+		ext := int(binary.BigEndian.Uint32(body))
+		if version == 4 {
+			ext = syncsafe(body[:4])
+		} else {
+			ext += 4
+		}
+		body = body[min(len(body), ext):]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	for len(body) >= headerLen && body[0] != 0 {
+		id := string(body[:idLen])
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(body[4:8]))
+		default:
+			frameSize = syncsafe(body[4:8])
+		}
+		if frameSize > len(body)-headerLen {
+			break
+		}
+		value := body[headerLen : headerLen+frameSize]
+		body = body[headerLen+frameSize:]
+
+		switch id {
+		case "TIT2", "TT2":
+			tags.set(&tags.Title, id3Text(value))
+		case "TPE1", "TP1":
+			tags.set(&tags.Artist, id3Text(value))
+		case "TALB", "TAL":
+			tags.set(&tags.Album, id3Text(value))
+		}
+	}
+	return total, nil
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// id3Text decodes a text frame, whose first byte is its encoding. Only the
+// first of several null separated values is kept.
+func id3Text(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	encoding, b := b[0], b[1:]
+	switch encoding {
+	case 0:
+		runes := make([]rune, 0, len(b))
+		for _, c := range b {
+			if c == 0 {
+				break
+			}
+			runes = append(runes, rune(c))
+		}
+		return string(runes)
+	case 1, 2:
+		var order binary.ByteOrder = binary.BigEndian
+		if encoding == 1 && len(b) >= 2 {
+			if b[0] == 0xff && b[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			if b[0] == 0xff && b[1] == 0xfe || b[0] == 0xfe && b[1] == 0xff {
+				b = b[2:]
+			}
+		}
+		units := make([]uint16, 0, len(b)/2)
+		for i := 0; i+1 < len(b); i += 2 {
+			u := order.Uint16(b[i:])
+			if u == 0 {
+				break
+			}
+			units = append(units, u)
+		}
+		return string(utf16.Decode(units))
+	default:
+		s, _, _ := strings.Cut(string(b), "\x00")
+		return s
+	}
+}
@@ -0,0 +1,92 @@
+package signal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encodeTestID3(version byte, frames map[string][]byte) []byte {
+	var body bytes.Buffer
+	for id, value := range frames {
+		body.WriteString(id)
+		if version == 4 {
+			body.Write([]byte{0, 0, byte(len(value) >> 7), byte(len(value) & 0x7f)})
+		} else {
+			binary.Write(&body, binary.BigEndian, uint32(len(value)))
+		}
+		body.Write([]byte{0, 0})
+		body.Write(value)
+	}
+	body.Write(make([]byte, 16)) // padding
+
+	size := body.Len()
+	tag := []byte{'I', 'D', '3', version, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(tag, body.Bytes()...)
+}
+
+func TestReadTags(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// WAV with a LIST/INFO chunk after the audio and an id3 chunk, whose
+	// title loses to the INFO one.
+	var info bytes.Buffer
+	info.WriteString("INFO")
+	for _, field := range [][2]string{{"INAM", "Song A\x00"}, {"IART", "Band\x00"}} {
+		info.WriteString(field[0])
+		binary.Write(&info, binary.LittleEndian, uint32(len(field[1])))
+		info.WriteString(field[1])
+		if len(field[1])%2 == 1 {
+			info.WriteByte(0)
+		}
+	}
+	wav := encodeTestWAV(wavFormatPCM, 16, 1, make([]byte, 8))
+	wav = binary.LittleEndian.AppendUint32(append(wav, "LIST"...), uint32(info.Len()))
+	wav = append(wav, info.Bytes()...)
+	id3 := encodeTestID3(3, map[string][]byte{
+		"TIT2": []byte("\x00Other"),
+		"TALB": {1, 0xff, 0xfe, 'A', 0, 'l', 0, 'b', 0, 0xe9, 0, 0, 0},
+	})
+	wav = binary.LittleEndian.AppendUint32(append(wav, "id3 "...), uint32(len(id3)))
+	wav = append(wav, id3...)
+
+	// FLAC with a Vorbis comment block after STREAMINFO.
+	var comments bytes.Buffer
+	for _, s := range []string{"vendor", "title=Song B", "ARTIST=Someone", "ALBUM=Record"} {
+		binary.Write(&comments, binary.LittleEndian, uint32(len(s)))
+		comments.WriteString(s)
+		if s == "vendor" {
+			binary.Write(&comments, binary.LittleEndian, uint32(3))
+		}
+	}
+	flac := append([]byte("fLaC\x00\x00\x00\x22"), make([]byte, 34)...)
+	flac = append(flac, 0x84, 0, byte(comments.Len()>>8), byte(comments.Len()))
+	flac = append(flac, comments.Bytes()...)
+
+	cases := map[string]Tags{
+		write("a.wav", wav): {Title: "Song A", Artist: "Band", Album: "Albé"},
+		write("b.flac", append(encodeTestID3(4, map[string][]byte{"TPE1": []byte("\x03Prefixed")}), flac...)): {Title: "Song B", Artist: "Prefixed", Album: "Record"},
+		write("c.mp3", encodeTestID3(4, map[string][]byte{"TIT2": []byte("\x03Título\x00")})):                 {Title: "Título"},
+		write("d.wav", encodeTestWAV(wavFormatPCM, 16, 1, make([]byte, 8))):                                   {},
+		filepath.Join("testdata", "tagged.ogg"):                                                               {Title: "Ogg Song", Artist: "Ogg Band", Album: "Ogg Album"},
+		filepath.Join("testdata", "tone.ogg"):                                                                 {},
+	}
+	for path, want := range cases {
+		got, err := ReadTags(path)
+		if err != nil {
+			t.Errorf("%s: %v", filepath.Base(path), err)
+		}
+		if got != want {
+			t.Errorf("%s: got %+v, want %+v", filepath.Base(path), got, want)
+		}
+	}
+}
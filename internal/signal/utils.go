@@ -3,12 +3,11 @@ package signal
 import (
 	"encoding/csv"
 	"fmt"
+	"iter"
 	"log"
 	"math"
 	"math/cmplx"
 	"os"
-
-	"github.com/go-audio/wav"
 )
 
 type AudioData struct {
@@ -59,6 +58,19 @@ func ComputeMagnitudes(spectrum []complex128) []float64 {
 	return magnitudes
 }
 
+func HanningWindow(n int) []float64 {
+	window := make([]float64, n)
+	if n == 1 {
+		window[0] = 1
+		return window
+	}
+	for i := range window {
+		window[i] = 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/float64(n-1)))
+	}
+
+	return window
+}
+
 func ApplyHanningWindow(input []float64) []float64 {
 	n := len(input)
 	output := make([]float64, n)
@@ -73,73 +85,69 @@ func ApplyHanningWindow(input []float64) []float64 {
 func ReadWavToFloats(path string) (*AudioData, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer f.Close()
 
-	decoder := wav.NewDecoder(f)
-	if !decoder.IsValidFile() {
-		return nil, fmt.Errorf("invalid wav file")
-	}
-
-	buf, err := decoder.FullPCMBuffer()
+	r, err := newWAVReader(f)
 	if err != nil {
 		return nil, err
 	}
-
-	numChannels := buf.Format.NumChannels
-	numSamples := len(buf.Data) / numChannels
-
-	channels := make([][]float64, numChannels)
-	for i := range channels {
-		channels[i] = make([]float64, numSamples)
-	}
-
-	bitDepth := buf.SourceBitDepth
-	factor := math.Pow(2, float64(bitDepth)-1)
-
-	for i, sample := range buf.Data {
-		channelIdx := i % numChannels
-		sampleIdx := i / numChannels
-		channels[channelIdx][sampleIdx] = float64(sample) / factor
-	}
-
-	return &AudioData{
-		SampleRate: buf.Format.SampleRate,
-		Channels:   channels,
-	}, nil
+	return readAllFrames(r)
 }
 
-func GenerateCSV(audioPath string, file *os.File, winSize int) {
-	data, err := ReadWavToFloats(audioPath)
+// GenerateCSV writes the magnitude spectrogram of audioPath as one row per
+// frame. With ChannelAll every channel gets its own set of columns, with
+// headers prefixed by the channel name.
+func GenerateCSV(audioPath string, file *os.File, winSize int, window Window, mode ChannelMode) {
+	data, err := ReadAudio(audioPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	signals, err := data.Select(mode)
 	if err != nil {
 		log.Fatal(err)
 	}
-	samples := data.Channels[0]
+	modes := mode.Split(len(data.Channels))
 	sampleRate := data.SampleRate
 
 	writer := csv.NewWriter(file)
 	defer writer.Flush()
 
+	stft := NewSTFT(winSize, winSize/2)
+	stft.Window = window
+
 	header := []string{"Time_Sec"}
-	for k := range winSize / 2 {
-		freq := float64(k) * float64(sampleRate) / float64(winSize)
-		header = append(header, fmt.Sprintf("%.0fHz", freq))
+	for _, m := range modes {
+		prefix := ""
+		if mode.Kind == ChannelAll {
+			prefix = m.String() + "_"
+		}
+		for k := range stft.Bins() {
+			header = append(header, fmt.Sprintf("%s%.0fHz", prefix, stft.BinFrequency(k, sampleRate)))
+		}
 	}
 	writer.Write(header)
 
-	hopSize := winSize / 2
-	for i := 0; i < len(samples)-winSize; i += hopSize {
-		chunk := samples[i : i+hopSize]
-		windowed := ApplyHanningWindow(chunk)
-		padded := PadDataToPowerOfTwo(windowed)
-		fftRes := FFT(padded)
-		mags := ComputeMagnitudes(fftRes)
-
-		row := make([]string, len(mags)+1)
-		row[0] = fmt.Sprintf("%.3f", float64(i)/float64(sampleRate))
-		for k, v := range mags {
-			row[k+1] = fmt.Sprintf("%.2f", v)
+	// Every signal has the same length, so their frames line up.
+	nexts := make([]func() (Frame, bool), len(signals))
+	for i, samples := range signals {
+		next, stop := iter.Pull(stft.Frames(samples, sampleRate))
+		defer stop()
+		nexts[i] = next
+	}
+
+	for {
+		row := []string{""}
+		for _, next := range nexts {
+			frame, ok := next()
+			if !ok {
+				return
+			}
+			row[0] = fmt.Sprintf("%.3f", frame.Time)
+			for _, v := range frame.Magnitudes {
+				row = append(row, fmt.Sprintf("%.2f", v))
+			}
 		}
 		writer.Write(row)
 	}
@@ -0,0 +1,76 @@
+package signal
+
+import (
+	"io"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// vorbisDecoder decodes an Ogg Vorbis stream through oggvorbis, which
+// interleaves the channels. Seeking bisects the Ogg pages by granule
+// position.
+type vorbisDecoder struct {
+	r   *oggvorbis.Reader
+	buf []float32
+}
+
+func newVorbisDecoder(rs io.ReadSeeker) (*vorbisDecoder, error) {
+	r, err := oggvorbis.NewReader(rs)
+	if err != nil {
+		return nil, err
+	}
+	return &vorbisDecoder{r: r}, nil
+}
+
+func (d *vorbisDecoder) SampleRate() int {
+	return d.r.SampleRate()
+}
+
+func (d *vorbisDecoder) Channels() int {
+	return d.r.Channels()
+}
+
+// Length is the granule position of the last page, or -1 when the stream
+// could not be scanned for it.
+func (d *vorbisDecoder) Length() int64 {
+	if d.r.Length() == 0 {
+		return -1
+	}
+	return d.r.Length()
+}
+
+func (d *vorbisDecoder) Seek(offset int64, whence int) (int64, error) {
+	frame, err := seekTarget(offset, whence, d.r.Position(), d.Length())
+	if err != nil {
+		return 0, err
+	}
+	return frame, d.r.SetPosition(frame)
+}
+
+func (d *vorbisDecoder) Read(frames [][]float64) (int, error) {
+	channels := d.r.Channels()
+	want := len(frames[0]) * channels
+	if cap(d.buf) < want {
+		d.buf = make([]float32, want)
+	}
+	buf := d.buf[:want]
+
+	read := 0
+	var err error
+	for read < want && err == nil {
+		var m int
+		m, err = d.r.Read(buf[read:])
+		read += m
+	}
+	if err == io.EOF && read > 0 {
+		err = nil
+	}
+
+	n := read / channels
+	for i := range n {
+		for ch := range frames {
+			frames[ch][i] = float64(buf[i*channels+ch])
+		}
+	}
+	return n, err
+}
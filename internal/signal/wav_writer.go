@@ -0,0 +1,219 @@
+package signal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// SampleFormat is the encoding of the samples WAVWriter writes.
+type SampleFormat struct {
+	BitDepth int
+	Float    bool
+}
+
+var (
+	PCM16   = SampleFormat{BitDepth: 16}
+	PCM24   = SampleFormat{BitDepth: 24}
+	PCM32   = SampleFormat{BitDepth: 32}
+	Float32 = SampleFormat{BitDepth: 32, Float: true}
+)
+
+// ParseSampleFormat reads a format as given on the command line: 16, 24, 32
+// or f32.
+func ParseSampleFormat(spec string) (SampleFormat, error) {
+	switch strings.ToLower(spec) {
+	case "16", "s16", "pcm16":
+		return PCM16, nil
+	case "24", "s24", "pcm24":
+		return PCM24, nil
+	case "32", "s32", "pcm32":
+		return PCM32, nil
+	case "f32", "float", "float32":
+		return Float32, nil
+	}
+	return SampleFormat{}, fmt.Errorf("unknown sample format '%s', expected 16, 24, 32 or f32", spec)
+}
+
+func (f SampleFormat) String() string {
+	if f.Float {
+		return fmt.Sprintf("%d-bit float", f.BitDepth)
+	}
+	return fmt.Sprintf("%d-bit PCM", f.BitDepth)
+}
+
+// WAVWriter encodes samples into a WAV file as they are written. The chunk
+// sizes in the header are only known at the end, so Close seeks back to fill
+// them in.
+type WAVWriter struct {
+	ws        io.WriteSeeker
+	w         *bufio.Writer
+	format    SampleFormat
+	channels  int
+	frames    int64
+	frameBuf  []byte
+	headerLen int64
+}
+
+func NewWAVWriter(ws io.WriteSeeker, sampleRate, channels int, format SampleFormat) (*WAVWriter, error) {
+	switch {
+	case format.Float && format.BitDepth != 32:
+		return nil, fmt.Errorf("unsupported float bit depth %d", format.BitDepth)
+	case !format.Float && format.BitDepth != 16 && format.BitDepth != 24 && format.BitDepth != 32:
+		return nil, fmt.Errorf("unsupported pcm bit depth %d", format.BitDepth)
+	case channels < 1 || channels > 0xffff || sampleRate < 1:
+		return nil, fmt.Errorf("invalid wav format: %d channels, %d Hz", channels, sampleRate)
+	}
+
+	w := &WAVWriter{
+		ws:       ws,
+		w:        bufio.NewWriterSize(ws, 64*1024),
+		format:   format,
+		channels: channels,
+		frameBuf: make([]byte, channels*format.BitDepth/8),
+	}
+	if err := w.writeHeader(sampleRate); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *WAVWriter) writeHeader(sampleRate int) error {
+	blockAlign := len(w.frameBuf)
+
+	// WAVE_FORMAT_EXTENSIBLE is required for more than two channels or more
+	// than 16 bits per sample.
+	extensible := w.channels > 2 || w.format.BitDepth > 16
+	formatTag := uint16(wavFormatPCM)
+	if w.format.Float {
+		formatTag = wavFormatFloat
+	}
+
+	var fmtChunk []byte
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, formatTag)
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(w.channels))
+	fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, uint32(sampleRate))
+	fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, uint32(sampleRate*blockAlign))
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(blockAlign))
+	fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(w.format.BitDepth))
+	if extensible {
+		binary.LittleEndian.PutUint16(fmtChunk[0:2], wavFormatExtensible)
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, 22)
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, uint16(w.format.BitDepth))
+		fmtChunk = binary.LittleEndian.AppendUint32(fmtChunk, 0)
+		// The subformat GUID is the format tag followed by a fixed suffix.
+		fmtChunk = binary.LittleEndian.AppendUint16(fmtChunk, formatTag)
+		fmtChunk = append(fmtChunk, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71)
+	}
+
+	var header []byte
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, 0)
+	header = append(header, "WAVE"...)
+	header = append(header, "fmt "...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(fmtChunk)))
+	header = append(header, fmtChunk...)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, 0)
+
+	w.headerLen = int64(len(header))
+	_, err := w.w.Write(header)
+	return err
+}
+
+// Write encodes len(frames[0]) frames, one slice per channel. Integer
+// formats clip samples outside [-1, 1].
+func (w *WAVWriter) Write(frames [][]float64) error {
+	if len(frames) != w.channels {
+		return fmt.Errorf("writing %d channels to a %d channel wav", len(frames), w.channels)
+	}
+
+	width := w.format.BitDepth / 8
+	scale := math.Ldexp(1, w.format.BitDepth-1)
+	for i := range frames[0] {
+		for ch := range frames {
+			raw := w.frameBuf[ch*width : (ch+1)*width]
+			if w.format.Float {
+				binary.LittleEndian.PutUint32(raw, math.Float32bits(float32(frames[ch][i])))
+				continue
+			}
+
+			v := math.Round(frames[ch][i] * scale)
+			v = max(-scale, min(scale-1, v))
+			bits := uint64(int64(v))
+			for b := range raw {
+				raw[b] = byte(bits >> (8 * b))
+			}
+		}
+		if _, err := w.w.Write(w.frameBuf); err != nil {
+			return err
+		}
+		w.frames++
+	}
+
+	return nil
+}
+
+// Close flushes the samples and writes the final chunk sizes. It does not
+// close the underlying writer.
+func (w *WAVWriter) Close() error {
+	dataSize := w.frames * int64(len(w.frameBuf))
+	if dataSize%2 != 0 {
+		if err := w.w.WriteByte(0); err != nil {
+			return err
+		}
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+
+	riffSize := w.headerLen - 8 + dataSize + dataSize%2
+	if riffSize > math.MaxUint32 {
+		return fmt.Errorf("wav data of %d bytes exceeds the 4 GiB limit", dataSize)
+	}
+
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(riffSize))
+	if _, err := w.ws.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.ws.Write(size[:]); err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(size[:], uint32(dataSize))
+	if _, err := w.ws.Seek(w.headerLen-4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.ws.Write(size[:]); err != nil {
+		return err
+	}
+
+	_, err := w.ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+// WriteWAV encodes data into a new WAV file at path.
+func WriteWAV(path string, data *AudioData, format SampleFormat) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := NewWAVWriter(f, data.SampleRate, len(data.Channels), format)
+	if err != nil {
+		return err
+	}
+	if err := w.Write(data.Channels); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
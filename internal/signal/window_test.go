@@ -0,0 +1,80 @@
+package signal
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWindowGains(t *testing.T) {
+	cases := []struct {
+		window       Window
+		coherentGain float64
+		enbw         float64
+	}{
+		{Rectangular, 1.0, 1.0},
+		{Hann, 0.5, 1.5},
+		{Hamming, 0.54, 1.363},
+		{Blackman, 0.42, 1.727},
+		{BlackmanHarris, 0.35875, 2.004},
+		{FlatTop, 0.2156, 3.77},
+	}
+
+	n := 8192
+	for _, c := range cases {
+		if cg := c.window.CoherentGain(n); math.Abs(cg-c.coherentGain) > 1e-3 {
+			t.Errorf("%s: coherent gain %f, want %f", c.window.Name, cg, c.coherentGain)
+		}
+		if enbw := c.window.ENBW(n); math.Abs(enbw-c.enbw) > 1e-2 {
+			t.Errorf("%s: ENBW %f, want %f", c.window.Name, enbw, c.enbw)
+		}
+	}
+}
+
+func TestParametricWindowLimits(t *testing.T) {
+	n := 1024
+	if math.Abs(Tukey(1).CoherentGain(n)-Hann.CoherentGain(n)) > 1e-9 {
+		t.Error("tukey:1 should match hann")
+	}
+	if Tukey(0).CoherentGain(n) != 1 || Kaiser(0).CoherentGain(n) != 1 {
+		t.Error("tukey:0 and kaiser:0 should be rectangular")
+	}
+
+	w := Gaussian(0.4).Func(n)
+	if math.Abs(w[0]-math.Exp(-0.5/0.16)) > 1e-9 || w[0] != w[n-1] {
+		t.Errorf("unexpected gaussian edges %f %f", w[0], w[n-1])
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	for _, spec := range []string{"hann", "Hanning", "flattop", "kaiser", "kaiser:6", "tukey:0.25", "gaussian:0.3"} {
+		if _, err := ParseWindow(spec); err != nil {
+			t.Errorf("%s: %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"triangle", "hann:2", "kaiser:x", "gaussian:0"} {
+		if _, err := ParseWindow(spec); err == nil {
+			t.Errorf("%s: expected an error", spec)
+		}
+	}
+}
+
+func TestCalibratedMagnitudesReadSineAmplitude(t *testing.T) {
+	n := 4096
+	samples := make([]float64, n)
+	for i := range samples {
+		// Put the tone half way between two bins, the worst case for scalloping.
+		samples[i] = 0.3 * math.Sin(2*math.Pi*100.5*float64(i)/float64(n))
+	}
+
+	window := FlatTop.Func(n)
+	windowed := make([]float64, n)
+	for i := range samples {
+		windowed[i] = samples[i] * window[i]
+	}
+
+	mags := ComputeCalibratedMagnitudes(RFFT(windowed), n, window)
+	peak := max(mags[100], mags[101])
+	if math.Abs(peak-0.3) > 0.3*0.005 {
+		t.Fatalf("flat-top peak amplitude %f, want 0.3", peak)
+	}
+}
@@ -32,6 +32,12 @@ def verify_fingerprint(wav_file, json_file):
         print("Error: JSOn file not found.")
         sys.exit(1)
 
+    # Fingerprints record the band layout they were made with in their
+    # parameters (version 2 kept it at the top), older ones used the default.
+    layout = fingerprint.get("params", {}).get("bands") or fingerprint.get("bands") or {}
+    bands = [(b["min"], b["max"]) for b in layout.get("ranges", [])]
+    bands = bands or BANDS
+
     points = fingerprint["points"]
     t_coords = [p["t"] for p in points]
     f_coords = [p["f"] for p in points]
@@ -48,7 +54,7 @@ def verify_fingerprint(wav_file, json_file):
         t_coords, f_coords, color="red", s=25, marker="*", label="Detected peaks"
     )
 
-    for b_min, b_max in BANDS:
+    for b_min, b_max in bands:
         plt.axhline(y=b_max, color="blue", linestyle="--", linewidth=0.8, alpha=0.5)
 
     plt.title(f"Audio fingerprint: {wav_file}")
@@ -56,7 +62,7 @@ def verify_fingerprint(wav_file, json_file):
     plt.xlabel("Time (s)")
     plt.legend(loc="upper right")
 
-    plt.ylim(0, 11000)
+    plt.ylim(0, max(b_max for _, b_max in bands) * 1.1)
     # plt.xlim(0, fingerprint["duration"])
 
     plt.tight_layout()
@@ -34,8 +34,16 @@ func main() {
 		cmds.RunReplCmd()
 	case "import":
 		cmds.RunImportCmd(args)
+	case "convert":
+		cmds.RunConvertCmd(args)
 	case "fpdir":
 		cmds.RunFingerprintDir(args)
+	case "db":
+		cmds.RunDbCmd(args)
+	case "index":
+		cmds.RunIndexCmd(args)
+	case "fpconvert":
+		cmds.RunFingerprintConvertCmd(args)
 	case "demo":
 		cmds.RunDemoCmd()
 	case "-h", "--help", "help":
@@ -52,7 +60,7 @@ func printHelp() {
 	audateci := color.BlueString(" audateci ")
 	command := color.CyanString("<command> ")
 	options := color.GreenString("[options] ")
-	file := color.CyanString("<audio-file.wav>")
+	file := color.CyanString("<audio-file>")
 	usageStyle.Print("Usage:")
 	println(audateci + command + options + file)
 
@@ -63,9 +71,13 @@ func printHelp() {
 
 	cmdsStyle := color.New(color.FgCyan)
 	println(cmdsStyle.Sprint("    analyze") + "        Analyze the audio file and export data to csv")
-	println(cmdsStyle.Sprint("    fingerprint") + "    Calculate the audio fingerprint of wav file and export it to json format")
+	println(cmdsStyle.Sprint("    convert") + "        Convert an audio file to wav, changing its sample rate, bit depth or channels")
+	println(cmdsStyle.Sprint("    db") + "             Add, remove, list and check the songs of a fingerprint database")
+	println(cmdsStyle.Sprint("    fingerprint") + "    Calculate the audio fingerprint of an audio file and export it to json format")
+	println(cmdsStyle.Sprint("    fpconvert") + "      Convert fingerprints between the json and the compact binary format")
 	println(cmdsStyle.Sprint("    identify") + "       Run a match between a given audio file and a directory containing audio fingerprints")
 	println(cmdsStyle.Sprint("    import") + "         Create a fingerprint database from a list of songs")
+	println(cmdsStyle.Sprint("    index") + "          Build the index identify uses to search a directory of fingerprints")
 	println(cmdsStyle.Sprint("    listen") + "         Visualize the frequencies contained in the audio file")
 	println(cmdsStyle.Sprint("    match") + "          Decide if two fingerprints have a match and what is the offset between them")
 	println(cmdsStyle.Sprint("    repl") + "           Run the audateci repl")